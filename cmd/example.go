@@ -6,18 +6,20 @@ package cmd
 import (
 	"encoding/json"
 	"fmt"
+	"os"
 	"time"
 
 	"github.com/paragor/faraway-edge/pkg/encodinghelper"
 	"github.com/paragor/faraway-edge/pkg/envoy"
 	"github.com/spf13/cobra"
+	"go.yaml.in/yaml/v3"
 )
 
 // exampleCmd represents the example command
 var exampleCmd = &cobra.Command{
 	Use:   "example",
 	Short: "Generate an example LogicalCluster configuration",
-	Long: `Generate an example LogicalCluster configuration in JSON format that can be
+	Long: `Generate an example LogicalCluster configuration in JSON or YAML format that can be
 used as a template for creating your own configuration file.
 
 The example includes:
@@ -28,8 +30,11 @@ The example includes:
 
 Example:
   faraway-edge example > config.json
+  faraway-edge example --format yaml > config.yaml
   faraway-edge example | jq .`,
 	Run: func(cmd *cobra.Command, args []string) {
+		format, _ := cmd.Flags().GetString("format")
+
 		cluster := &envoy.LogicalCluster{
 			Name: "static",
 			Ingresses: []*envoy.LogicalClusterIngress{
@@ -56,15 +61,32 @@ Example:
 				},
 			},
 		}
-		data, err := json.MarshalIndent(cluster, "", "  ")
-		if err != nil {
-			panic(err)
+		switch format {
+		case "json":
+			data, err := json.MarshalIndent(cluster, "", "  ")
+			if err != nil {
+				panic(err)
+			}
+			fmt.Println(string(data))
+		case "yaml":
+			encoder := yaml.NewEncoder(os.Stdout)
+			encoder.SetIndent(2)
+			if err := encoder.Encode(cluster); err != nil {
+				panic(err)
+			}
+			if err := encoder.Close(); err != nil {
+				panic(err)
+			}
+		default:
+			fmt.Fprintf(os.Stderr, "unknown format %q, expected json or yaml\n", format)
+			os.Exit(1)
 		}
-		fmt.Println(string(data))
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(exampleCmd)
 
+	exampleCmd.Flags().String("format", "json", "Output format: json or yaml")
+
 }
@@ -5,8 +5,9 @@ package cmd
 
 import (
 	"context"
-	"encoding/json"
+	"fmt"
 	"log/slog"
+	"net/http"
 	"os"
 	"os/signal"
 	"strings"
@@ -15,11 +16,19 @@ import (
 
 	"github.com/paragor/faraway-edge/pkg/diags"
 	"github.com/paragor/faraway-edge/pkg/envoy"
+	"github.com/paragor/faraway-edge/pkg/file"
 	"github.com/paragor/faraway-edge/pkg/k8s"
 	"github.com/paragor/faraway-edge/pkg/log"
 	"github.com/spf13/cobra"
 )
 
+// fileProvider is a LogicalClusterProvider backed by watched files
+type fileProvider interface {
+	envoy.LogicalClusterProvider
+	Run(ctx context.Context) error
+	Status() error
+}
+
 // runCmd represents the run command
 var runCmd = &cobra.Command{
 	Use:   "run",
@@ -27,40 +36,77 @@ var runCmd = &cobra.Command{
 	Long: `Start the Envoy xDS control plane server that provides dynamic configuration
 to Envoy proxies via the xDS protocol.
 
-The server reads a LogicalCluster configuration from a JSON file and translates it
+The server reads a LogicalCluster configuration from a JSON or YAML file and translates it
 into Envoy listener, cluster, and route resources. It serves these configurations
 via gRPC on the specified xDS port.
 
+The static file is watched and reloaded on change or on SIGHUP. An invalid file
+is rejected and the last good configuration keeps being served; the load error
+is reported on the diags /providers endpoint.
+
+With --static-dir every JSON or YAML file in the directory becomes its own LogicalCluster.
+Cluster names and domains must be unique across files.
+
+With --view-config Envoy nodes can be split into node groups, selected by node
+cluster, node id glob or node metadata. Each group receives only its own
+LogicalClusters and listener ports, with its own snapshot version. Nodes that
+match no group receive the full view.
+
 Example:
   faraway-edge run --static-path config.json
-  faraway-edge run --static-path config.json --xds-port 19000`,
+  faraway-edge run --static-dir /etc/faraway-edge/clusters
+  faraway-edge run --static-path config.json --xds-port 19000
+  faraway-edge run --static-path config.json --xds-listen 10.0.0.5:18000 --diags-listen 127.0.0.1:8080
+  faraway-edge run --static-path config.json --xds-listen unix:///run/faraway-edge/xds.sock`,
 	Run: func(cmd *cobra.Command, args []string) {
 		ctx := context.Background()
 		logger := log.FromContext(ctx)
 
 		xdsPort, _ := cmd.Flags().GetInt("xds-port")
+		xdsListen, _ := cmd.Flags().GetString("xds-listen")
+		if xdsListen == "" {
+			xdsListen = fmt.Sprintf(":%d", xdsPort)
+		}
+		diagsListen, _ := cmd.Flags().GetString("diags-listen")
 		staticPath, _ := cmd.Flags().GetString("static-path")
+		staticDir, _ := cmd.Flags().GetString("static-dir")
+		viewConfigPath, _ := cmd.Flags().GetString("view-config")
 		token, _ := cmd.Flags().GetString("token")
+		adminToken, _ := cmd.Flags().GetString("admin-token")
+		stateFile, _ := cmd.Flags().GetString("state-file")
+		providerMaxStaleness, _ := cmd.Flags().GetDuration("provider-max-staleness")
+		conflictPolicy, _ := cmd.Flags().GetString("conflict-policy")
+		providerPriority, _ := cmd.Flags().GetStringSlice("provider-priority")
 
-		providers := []envoy.LogicalClusterProvider{}
-		if staticPath != "" {
-			data, err := os.ReadFile(staticPath)
+		var viewConfig *envoy.ViewConfig
+		if viewConfigPath != "" {
+			var err error
+			viewConfig, err = file.LoadViewConfig(viewConfigPath)
 			if err != nil {
-				logger.Error("Error reading file", slog.String("path", staticPath), log.Error(err))
+				logger.Error("Cant load view config", slog.String("path", viewConfigPath), log.Error(err))
 				os.Exit(1)
 			}
+		}
 
-			cluster := &envoy.LogicalCluster{}
-			if err := json.Unmarshal(data, cluster); err != nil {
-				logger.Error("Error parsing JSON", slog.String("path", staticPath), log.Error(err))
+		providers := []envoy.LogicalClusterProvider{}
+		fileProviders := []fileProvider{}
+		if staticPath != "" {
+			provider, err := file.NewFileProvider(staticPath)
+			if err != nil {
+				logger.Error("Cant load static config", slog.String("path", staticPath), log.Error(err))
 				os.Exit(1)
 			}
-
-			if err := cluster.Validate(); err != nil {
-				logger.Error("Configuration validation failed", log.Error(err))
+			fileProviders = append(fileProviders, provider)
+			providers = append(providers, provider)
+		}
+		if staticDir != "" {
+			provider, err := file.NewDirectoryProvider(staticDir)
+			if err != nil {
+				logger.Error("Cant load static config directory", slog.String("dir", staticDir), log.Error(err))
 				os.Exit(1)
 			}
-			providers = append(providers, envoy.NewStaticLogicalClusterProvider(cluster))
+			fileProviders = append(fileProviders, provider)
+			providers = append(providers, provider)
 		}
 
 		// Set up signal handling
@@ -77,6 +123,13 @@ Example:
 			cancel()
 		}()
 
+		fileProviderErrChan := make(chan error, len(fileProviders))
+		for _, provider := range fileProviders {
+			go func() {
+				fileProviderErrChan <- provider.Run(ctx)
+			}()
+		}
+
 		k8sProviderErrChan := make(chan error, 1)
 		k8sEnabled, _ := cmd.Flags().GetBool("k8s-enabled")
 		if k8sEnabled {
@@ -111,13 +164,56 @@ Example:
 			providers = append(providers, k8sProvider)
 		}
 
+		conflicts := envoy.ConflictConfig{
+			Policy:           envoy.ConflictPolicy(conflictPolicy),
+			ProviderPriority: providerPriority,
+		}
+		if err := conflicts.Validate(providers); err != nil {
+			logger.Error("Invalid conflict policy", log.Error(err))
+			os.Exit(1)
+		}
+		if viewConfig != nil {
+			if err := viewConfig.ValidateClusterNames(providers); err != nil {
+				logger.Error("Invalid view config", slog.String("path", viewConfigPath), log.Error(err))
+				os.Exit(1)
+			}
+		}
 		xds := envoy.NewXDS(
-			xdsPort,
+			xdsListen,
 			providers,
 			token,
+			viewConfig,
+			stateFile,
+			providerMaxStaleness,
+			conflicts,
 		)
 		// Create HTTP server
-		httpServer := diags.NewHTTPServer(8080, xds.DumpCurrentSnapshot)
+		httpServer := diags.NewHTTPServer(diagsListen, adminToken, xds.DumpCurrentSnapshot)
+		for _, provider := range fileProviders {
+			rejected := xds.ProviderStatus(provider)
+			httpServer.AddProviderStatus(provider.Name(), func() error {
+				if err := provider.Status(); err != nil {
+					return err
+				}
+				return rejected()
+			})
+		}
+		httpServer.AddJSONEndpoint("/config-status", xds.ConfigStatus)
+		httpServer.AddJSONEndpoint("/nodes", xds.ConnectedNodes)
+		httpServer.AddJSONEndpoint("/history", xds.History)
+		httpServer.AddJSONEndpoint("/conflicts", xds.Conflicts)
+		httpServer.AddAdminEndpoint("/pin", func(r *http.Request) error {
+			return xds.Pin(ctx, r.URL.Query().Get("version"))
+		})
+		httpServer.AddAdminEndpoint("/unpin", func(r *http.Request) error {
+			return xds.Unpin(ctx)
+		})
+		httpServer.AddLivenessCheck("update_loop", xds.CheckUpdateLoop)
+		httpServer.AddReadinessCheck("initial_snapshot", xds.CheckSnapshot)
+		httpServer.AddReadinessCheck("xds_listener", xds.CheckListener)
+		for _, provider := range providers {
+			httpServer.AddReadinessCheck("provider "+provider.Name(), xds.ProviderCheck(provider))
+		}
 
 		// Start HTTP server in background
 		httpErrChan := make(chan error, 1)
@@ -132,13 +228,16 @@ Example:
 		// Start XDS server in background
 		xdsErrChan := make(chan error, 1)
 		go func() {
-			xdsErrChan <- xds.RunServer(ctx, time.Second*60, func() {
-				httpServer.SetReady(true)
-			})
+			xdsErrChan <- xds.RunServer(ctx, time.Second*60)
 		}()
 
 		// Wait for either server to error or context cancellation
 		select {
+		case err := <-fileProviderErrChan:
+			if err != nil {
+				logger.Error("Error running static file provider", log.Error(err))
+				os.Exit(1)
+			}
 		case err := <-k8sProviderErrChan:
 			if err != nil {
 				logger.Error("Error running xDS server", log.Error(err))
@@ -163,9 +262,18 @@ Example:
 func init() {
 	rootCmd.AddCommand(runCmd)
 
-	runCmd.Flags().Int("xds-port", 18000, "Port for XDS server")
-	runCmd.Flags().String("static-path", "", "Path to JSON file containing LogicalCluster configuration (optional)")
+	runCmd.Flags().Int("xds-port", 18000, "Port for XDS server on all interfaces, ignored when --xds-listen is set")
+	runCmd.Flags().String("xds-listen", "", "Listen address for XDS server: host:port, [ipv6]:port or unix:///path (default \":<xds-port>\")")
+	runCmd.Flags().String("diags-listen", ":8080", "Listen address for diags HTTP server: host:port, [ipv6]:port or unix:///path")
+	runCmd.Flags().String("static-path", "", "Path to JSON or YAML file containing LogicalCluster configuration (optional)")
+	runCmd.Flags().String("static-dir", "", "Path to directory with one LogicalCluster JSON or YAML file per cluster (optional)")
+	runCmd.Flags().String("view-config", "", "Path to JSON or YAML file with node groups deciding which Envoy nodes receive which clusters (optional)")
 	runCmd.Flags().String("token", "", "Authentication token for gRPC xDS server (optional)")
+	runCmd.Flags().String("state-file", "", "Path to a file persisting the last applied view, served on startup while providers warm up (optional)")
+	runCmd.Flags().Duration("provider-max-staleness", 0, "How long a failing provider keeps contributing its last valid clusters before they are dropped, 0 means forever")
+	runCmd.Flags().String("conflict-policy", string(envoy.ConflictRejectAll), "What to do when ingresses claim the same domain: reject-all, first-wins, provider-priority or drop-both")
+	runCmd.Flags().StringSlice("provider-priority", nil, "Provider names for the provider-priority conflict policy, highest first, e.g. static:/etc/edge.yaml,k8s:k8s-local")
+	runCmd.Flags().String("admin-token", "", "Bearer token for diags admin endpoints such as /pin, which are disabled when empty")
 	runCmd.Flags().Bool("k8s-enabled", true, "Enable local k8s")
 	runCmd.Flags().String("k8s-cluster-name", "k8s-local", "K8s cluster name")
 	runCmd.Flags().String("k8s-ingress-classes", "", "k8s ingress class classes split by ,")
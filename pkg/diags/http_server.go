@@ -2,59 +2,202 @@ package diags
 
 import (
 	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
-	"sync/atomic"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/paragor/faraway-edge/pkg/log"
+	"github.com/paragor/faraway-edge/pkg/utils"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 type HTTPServer struct {
-	port   int
-	ready  atomic.Bool
-	dumper func(io.Writer) error
+	listen     string
+	adminToken string
+	dumper     func(w io.Writer, group string) error
+
+	mu              sync.RWMutex
+	providerStatus  map[string]func() error
+	jsonEndpoints   map[string]func() any
+	adminEndpoints  map[string]func(r *http.Request) error
+	livenessChecks  []check
+	readinessChecks []check
+}
+
+// check is a named probe, healthy when it returns nil
+type check struct {
+	name string
+	run  func() error
+}
+
+type statusResponse struct {
+	Name     string `json:"name"`
+	OK       bool   `json:"ok"`
+	Degraded bool   `json:"degraded,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// degradedError is implemented by check errors that report a degraded but
+// working component. They are shown in the body without failing the probe.
+type degradedError interface {
+	Degraded() bool
+}
+
+type checksResponse struct {
+	Status string           `json:"status"`
+	Checks []statusResponse `json:"checks"`
 }
 
-func NewHTTPServer(port int, dumper func(io.Writer) error) *HTTPServer {
-	server := &HTTPServer{
-		port:   port,
-		dumper: dumper,
+// NewHTTPServer creates a diags server listening on listen, see utils.Listen for the address format.
+// Admin endpoints require adminToken as a bearer token and are disabled when it is empty.
+func NewHTTPServer(listen string, adminToken string, dumper func(w io.Writer, group string) error) *HTTPServer {
+	return &HTTPServer{
+		listen:         listen,
+		adminToken:     adminToken,
+		dumper:         dumper,
+		providerStatus: map[string]func() error{},
+		jsonEndpoints:  map[string]func() any{},
+		adminEndpoints: map[string]func(r *http.Request) error{},
 	}
-	server.ready.Store(false)
-	return server
 }
 
-func (s *HTTPServer) SetReady(ready bool) {
-	s.ready.Store(ready)
+// AddLivenessCheck registers a check reported on /healthz. A failing liveness
+// check means the process is stuck and should be restarted.
+func (s *HTTPServer) AddLivenessCheck(name string, run func() error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.livenessChecks = append(s.livenessChecks, check{name: name, run: run})
 }
 
-func (s *HTTPServer) handleHealthz(w http.ResponseWriter, r *http.Request) {
-	if s.ready.Load() {
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("ready"))
-	} else {
-		w.WriteHeader(http.StatusServiceUnavailable)
-		w.Write([]byte("not ready"))
+// AddReadinessCheck registers a check reported on /readyz. A failing readiness
+// check means the control plane cannot serve a correct config yet.
+func (s *HTTPServer) AddReadinessCheck(name string, run func() error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.readinessChecks = append(s.readinessChecks, check{name: name, run: run})
+}
+
+// AddProviderStatus registers a provider whose last load error is reported on /providers.
+func (s *HTTPServer) AddProviderStatus(name string, status func() error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.providerStatus[name] = status
+}
+
+// AddJSONEndpoint serves the result of get as JSON on path. Must be called before Run.
+func (s *HTTPServer) AddJSONEndpoint(path string, get func() any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jsonEndpoints[path] = get
+}
+
+// AddAdminEndpoint serves a POST endpoint changing the state of the control plane,
+// authenticated with the admin token. Must be called before Run.
+func (s *HTTPServer) AddAdminEndpoint(path string, handle func(r *http.Request) error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.adminEndpoints[path] = handle
+}
+
+func (s *HTTPServer) handleAdmin(handle func(r *http.Request) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		if s.adminToken == "" {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte("admin endpoints are disabled, set --admin-token to enable them"))
+			return
+		}
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.adminToken)) != 1 {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte("invalid admin token"))
+			return
+		}
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			w.Write([]byte("method not allowed, use POST"))
+			return
+		}
+		if err := handle(r); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		w.Write([]byte("ok"))
 	}
 }
 
-func (s *HTTPServer) handleReadyz(w http.ResponseWriter, r *http.Request) {
-	if s.ready.Load() {
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("ready"))
-	} else {
-		w.WriteHeader(http.StatusServiceUnavailable)
-		w.Write([]byte("not ready"))
+func (s *HTTPServer) handleProviders(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	result := make([]statusResponse, 0, len(s.providerStatus))
+	for name, status := range s.providerStatus {
+		item := statusResponse{Name: name, OK: true}
+		if err := status(); err != nil {
+			item.OK = false
+			item.Error = err.Error()
+		}
+		result = append(result, item)
 	}
+	s.mu.RUnlock()
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+func (s *HTTPServer) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	checks := s.livenessChecks
+	s.mu.RUnlock()
+	writeChecks(w, checks)
+}
+
+func (s *HTTPServer) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	checks := s.readinessChecks
+	s.mu.RUnlock()
+	writeChecks(w, checks)
 }
 
-func (s *HTTPServer) handleMetrics(w http.ResponseWriter, r *http.Request) {
-	// TODO: Implement actual metrics
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("# No metrics implemented yet\n"))
+// writeChecks runs every check and responds 200 if all pass or are only
+// degraded, 503 otherwise, with the result of each check in the body.
+func writeChecks(w http.ResponseWriter, checks []check) {
+	result := checksResponse{Status: "ok", Checks: make([]statusResponse, 0, len(checks))}
+	for _, check := range checks {
+		item := statusResponse{Name: check.name, OK: true}
+		err := check.run()
+		var degraded degradedError
+		switch {
+		case err == nil:
+		case errors.As(err, &degraded) && degraded.Degraded():
+			item.Degraded = true
+			item.Error = err.Error()
+			if result.Status == "ok" {
+				result.Status = "degraded"
+			}
+		default:
+			item.OK = false
+			item.Error = err.Error()
+			result.Status = "failing"
+		}
+		result.Checks = append(result.Checks, item)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if result.Status == "failing" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(result)
 }
 
 func (s *HTTPServer) Run(ctx context.Context) error {
@@ -62,17 +205,33 @@ func (s *HTTPServer) Run(ctx context.Context) error {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/healthz", s.handleHealthz)
 	mux.HandleFunc("/readyz", s.handleReadyz)
-	mux.HandleFunc("/metrics", s.handleMetrics)
+	mux.Handle("/metrics", promhttp.Handler())
+	mux.HandleFunc("/providers", s.handleProviders)
+	s.mu.RLock()
+	for path, get := range s.jsonEndpoints {
+		mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(get())
+		})
+	}
+	for path, handle := range s.adminEndpoints {
+		mux.HandleFunc(path, s.handleAdmin(handle))
+	}
+	s.mu.RUnlock()
 	mux.HandleFunc("/dump", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "text/plain")
-		if err := s.dumper(w); err != nil {
+		if err := s.dumper(w, r.URL.Query().Get("group")); err != nil {
 			w.WriteHeader(http.StatusServiceUnavailable)
 			w.Write([]byte(err.Error()))
 		}
 	})
 
+	lis, err := utils.Listen(s.listen)
+	if err != nil {
+		return fmt.Errorf("HTTP server failed to listen: %w", err)
+	}
+
 	httpServer := &http.Server{
-		Addr:    fmt.Sprintf(":%d", s.port),
 		Handler: mux,
 	}
 
@@ -83,8 +242,8 @@ func (s *HTTPServer) Run(ctx context.Context) error {
 		httpServer.Shutdown(shutdownCtx)
 	}()
 
-	logger.Info("diags HTTP server started", slog.Int("port", s.port))
-	if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+	logger.Info("diags HTTP server started", slog.String("listen", s.listen))
+	if err := httpServer.Serve(lis); err != nil && err != http.ErrServerClosed {
 		return fmt.Errorf("HTTP server failed: %w", err)
 	}
 	return nil
@@ -0,0 +1,241 @@
+package encodinghelper
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// DecodeError is a single problem found while strictly decoding a document.
+type DecodeError struct {
+	File    string
+	Line    int
+	Column  int
+	Path    string
+	Message string
+}
+
+func (e *DecodeError) Error() string {
+	location := e.File
+	if e.Line > 0 {
+		location = fmt.Sprintf("%s:%d:%d", e.File, e.Line, e.Column)
+	}
+	if e.Path == "" {
+		return location + ": " + e.Message
+	}
+	return location + ": " + e.Path + ": " + e.Message
+}
+
+// StrictDecodeJSON decodes a JSON document into out. See StrictDecodeYAML.
+func StrictDecodeJSON(file string, data []byte, out any) error {
+	var syntaxCheck any
+	if err := json.Unmarshal(data, &syntaxCheck); err != nil {
+		decodeErr := &DecodeError{File: file, Message: err.Error()}
+		var syntaxErr *json.SyntaxError
+		if errors.As(err, &syntaxErr) {
+			// Offset counts the bytes read, including the invalid one
+			decodeErr.Line, decodeErr.Column = lineAndColumn(data, syntaxErr.Offset-1)
+		}
+		return decodeErr
+	}
+	// JSON is a subset of YAML, and the YAML parser keeps line numbers for us
+	return StrictDecodeYAML(file, data, out)
+}
+
+// StrictDecodeYAML decodes a YAML document into out. Unlike yaml.Unmarshal it
+// keeps going after the first problem and reports every unknown field and type
+// mismatch with its line, column and JSON path. Field names are taken from json
+// tags, so yaml tags of out must use the same names.
+func StrictDecodeYAML(file string, data []byte, out any) error {
+	root := &yaml.Node{}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	if err := decoder.Decode(root); err != nil {
+		if errors.Is(err, io.EOF) {
+			return &DecodeError{File: file, Message: "document is empty"}
+		}
+		return &DecodeError{File: file, Message: err.Error()}
+	}
+	if root.Kind == yaml.DocumentNode && len(root.Content) > 0 {
+		root = root.Content[0]
+	}
+
+	checker := &strictChecker{file: file}
+	checker.check(root, reflect.TypeOf(out), "$")
+	if len(checker.errs) > 0 {
+		return errors.Join(checker.errs...)
+	}
+
+	if err := root.Decode(out); err != nil {
+		return &DecodeError{File: file, Message: err.Error()}
+	}
+	return nil
+}
+
+var yamlUnmarshalerType = reflect.TypeOf((*yaml.Unmarshaler)(nil)).Elem()
+
+type strictChecker struct {
+	file string
+	errs []error
+}
+
+func (c *strictChecker) fail(node *yaml.Node, path string, format string, args ...any) {
+	c.errs = append(c.errs, &DecodeError{
+		File:    c.file,
+		Line:    node.Line,
+		Column:  node.Column,
+		Path:    path,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+func (c *strictChecker) check(node *yaml.Node, typ reflect.Type, path string) {
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+
+	if typ.Kind() == reflect.Pointer {
+		if isNull(node) {
+			return
+		}
+		typ = typ.Elem()
+	}
+
+	if reflect.PointerTo(typ).Implements(yamlUnmarshalerType) {
+		value := reflect.New(typ)
+		if err := node.Decode(value.Interface()); err != nil {
+			c.fail(node, path, "%s", err.Error())
+		}
+		return
+	}
+
+	switch typ.Kind() {
+	case reflect.Struct:
+		if node.Kind != yaml.MappingNode {
+			c.fail(node, path, "expected an object, got %s", describeNode(node))
+			return
+		}
+		fields := jsonFields(typ)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			field, ok := fields[key.Value]
+			if !ok {
+				c.fail(key, path+"."+key.Value, "unknown field %q", key.Value)
+				continue
+			}
+			c.check(value, field.Type, path+"."+key.Value)
+		}
+	case reflect.Slice:
+		if isNull(node) {
+			return
+		}
+		if node.Kind != yaml.SequenceNode {
+			c.fail(node, path, "expected an array, got %s", describeNode(node))
+			return
+		}
+		for i, item := range node.Content {
+			c.check(item, typ.Elem(), fmt.Sprintf("%s[%d]", path, i))
+		}
+	case reflect.Map:
+		if isNull(node) {
+			return
+		}
+		if node.Kind != yaml.MappingNode {
+			c.fail(node, path, "expected an object, got %s", describeNode(node))
+			return
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			c.check(value, typ.Elem(), path+"."+key.Value)
+		}
+	case reflect.String:
+		if node.Kind != yaml.ScalarNode || node.ShortTag() != "!!str" {
+			c.fail(node, path, "expected a string, got %s", describeNode(node))
+		}
+	case reflect.Bool:
+		if node.Kind != yaml.ScalarNode || node.ShortTag() != "!!bool" {
+			c.fail(node, path, "expected a boolean, got %s", describeNode(node))
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if node.Kind != yaml.ScalarNode || node.ShortTag() != "!!int" {
+			c.fail(node, path, "expected an integer, got %s", describeNode(node))
+			return
+		}
+		if _, err := strconv.ParseInt(node.Value, 0, typ.Bits()); err != nil {
+			c.fail(node, path, "integer %s is out of range", node.Value)
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if node.Kind != yaml.ScalarNode || node.ShortTag() != "!!int" {
+			c.fail(node, path, "expected a non-negative integer, got %s", describeNode(node))
+			return
+		}
+		if strings.HasPrefix(node.Value, "-") {
+			c.fail(node, path, "expected a non-negative integer, got %s", node.Value)
+			return
+		}
+		if _, err := strconv.ParseUint(node.Value, 0, typ.Bits()); err != nil {
+			c.fail(node, path, "integer %s is out of range", node.Value)
+		}
+	case reflect.Float32, reflect.Float64:
+		if node.Kind != yaml.ScalarNode || (node.ShortTag() != "!!float" && node.ShortTag() != "!!int") {
+			c.fail(node, path, "expected a number, got %s", describeNode(node))
+		}
+	}
+}
+
+// jsonFields maps the json name of every exported field of typ to the field.
+func jsonFields(typ reflect.Type) map[string]reflect.StructField {
+	fields := map[string]reflect.StructField{}
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fields[name] = field
+	}
+	return fields
+}
+
+func isNull(node *yaml.Node) bool {
+	return node.Kind == yaml.ScalarNode && node.ShortTag() == "!!null"
+}
+
+func describeNode(node *yaml.Node) string {
+	switch node.Kind {
+	case yaml.MappingNode:
+		return "an object"
+	case yaml.SequenceNode:
+		return "an array"
+	case yaml.ScalarNode:
+		switch node.ShortTag() {
+		case "!!null":
+			return "null"
+		case "!!str":
+			return fmt.Sprintf("string %q", node.Value)
+		}
+		return node.Value
+	}
+	return "unsupported value"
+}
+
+// lineAndColumn returns the position of the byte at offset, or of the end of data.
+func lineAndColumn(data []byte, offset int64) (int, int) {
+	offset = min(max(offset, 0), int64(len(data)))
+	before := data[:offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	column := int(offset) - bytes.LastIndexByte(before, '\n')
+	return line, column
+}
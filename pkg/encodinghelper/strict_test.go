@@ -0,0 +1,242 @@
+package encodinghelper
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+type testUpstream struct {
+	Port      uint32   `json:"port" yaml:"port"`
+	Addresses []string `json:"addresses" yaml:"addresses"`
+	Timeout   Duration `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+}
+
+type testConfig struct {
+	Name      string            `json:"name" yaml:"name"`
+	Enabled   bool              `json:"enabled" yaml:"enabled"`
+	Weight    int8              `json:"weight" yaml:"weight"`
+	Upstream  *testUpstream     `json:"upstream" yaml:"upstream"`
+	Upstreams []*testUpstream   `json:"upstreams" yaml:"upstreams"`
+	Labels    map[string]string `json:"labels" yaml:"labels"`
+	internal  string
+}
+
+// decodeErrors returns the DecodeError of every problem reported by err.
+func decodeErrors(t *testing.T, err error) []*DecodeError {
+	t.Helper()
+	errs := []error{err}
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		errs = joined.Unwrap()
+	}
+	result := []*DecodeError{}
+	for _, err := range errs {
+		var decodeErr *DecodeError
+		if !errors.As(err, &decodeErr) {
+			t.Fatalf("error %q is not a *DecodeError", err)
+		}
+		result = append(result, decodeErr)
+	}
+	return result
+}
+
+func TestStrictDecodeYAML(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		// want are the expected problems as line:column path, empty when the document is valid
+		want []DecodeError
+	}{
+		{
+			name: "valid",
+			data: "name: a\nenabled: true\nweight: 3\nupstream: {port: 80, addresses: [10.0.0.1], timeout: 5s}\nlabels: {team: edge}\n",
+		},
+		{
+			name: "null pointer, slice and map",
+			data: "name: a\nupstream: null\nupstreams: null\nlabels: null\n",
+		},
+		{
+			name: "unknown field",
+			data: "name: a\nnmae: b\n",
+			want: []DecodeError{{Line: 2, Column: 1, Path: "$.nmae", Message: `unknown field "nmae"`}},
+		},
+		{
+			name: "unexported field is unknown",
+			data: "internal: a\n",
+			want: []DecodeError{{Line: 1, Column: 1, Path: "$.internal", Message: `unknown field "internal"`}},
+		},
+		{
+			name: "wrong scalar types",
+			data: "name: 5\nenabled: yes please\nweight: abc\n",
+			want: []DecodeError{
+				{Line: 1, Column: 7, Path: "$.name", Message: "expected a string, got 5"},
+				{Line: 2, Column: 10, Path: "$.enabled", Message: `expected a boolean, got string "yes please"`},
+				{Line: 3, Column: 9, Path: "$.weight", Message: `expected an integer, got string "abc"`},
+			},
+		},
+		{
+			name: "integer out of range",
+			data: "weight: 300\n",
+			want: []DecodeError{{Line: 1, Column: 9, Path: "$.weight", Message: "integer 300 is out of range"}},
+		},
+		{
+			name: "negative unsigned integer",
+			data: "upstream: {port: -1}\n",
+			want: []DecodeError{{Line: 1, Column: 18, Path: "$.upstream.port", Message: "expected a non-negative integer, got -1"}},
+		},
+		{
+			name: "object instead of array",
+			data: "upstreams: {port: 80}\n",
+			want: []DecodeError{{Line: 1, Column: 12, Path: "$.upstreams", Message: "expected an array, got an object"}},
+		},
+		{
+			name: "nested paths collect every error",
+			data: "upstreams:\n  - port: 80\n    adresses: [10.0.0.1]\n  - port: http\n    addresses: [1]\nlabels: {team: [a]}\n",
+			want: []DecodeError{
+				{Line: 3, Column: 5, Path: "$.upstreams[0].adresses", Message: `unknown field "adresses"`},
+				{Line: 4, Column: 11, Path: "$.upstreams[1].port", Message: `expected a non-negative integer, got string "http"`},
+				{Line: 5, Column: 17, Path: "$.upstreams[1].addresses[0]", Message: "expected a string, got 1"},
+				{Line: 6, Column: 16, Path: "$.labels.team", Message: "expected a string, got an array"},
+			},
+		},
+		{
+			name: "duration must be a string",
+			data: "upstream: {timeout: 5}\n",
+			want: []DecodeError{{Line: 1, Column: 21, Path: "$.upstream.timeout", Message: "invalid duration"}},
+		},
+		{
+			name: "invalid duration string",
+			data: "upstream: {timeout: five}\n",
+			want: []DecodeError{{Line: 1, Column: 21, Path: "$.upstream.timeout", Message: `time: invalid duration "five"`}},
+		},
+		{
+			name: "empty document",
+			data: "",
+			want: []DecodeError{{Message: "document is empty"}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			out := &testConfig{}
+			err := StrictDecodeYAML("config.yaml", []byte(test.data), out)
+			if len(test.want) == 0 {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("expected %d errors, got none", len(test.want))
+			}
+			got := decodeErrors(t, err)
+			if len(got) != len(test.want) {
+				t.Fatalf("expected %d errors, got %d: %v", len(test.want), len(got), err)
+			}
+			for i, want := range test.want {
+				want.File = "config.yaml"
+				if *got[i] != want {
+					t.Errorf("error %d: expected %+v, got %+v", i, want, *got[i])
+				}
+			}
+		})
+	}
+}
+
+func TestStrictDecodeYAMLValues(t *testing.T) {
+	out := &testConfig{}
+	data := "name: a\nenabled: true\nweight: -3\nupstreams: [{port: 80, addresses: [10.0.0.1, 10.0.0.2], timeout: 1m30s}]\n"
+	if err := StrictDecodeYAML("config.yaml", []byte(data), out); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if out.Name != "a" || !out.Enabled || out.Weight != -3 {
+		t.Errorf("unexpected scalars: %+v", out)
+	}
+	if len(out.Upstreams) != 1 {
+		t.Fatalf("expected 1 upstream, got %d", len(out.Upstreams))
+	}
+	upstream := out.Upstreams[0]
+	if upstream.Port != 80 || !slices.Equal(upstream.Addresses, []string{"10.0.0.1", "10.0.0.2"}) {
+		t.Errorf("unexpected upstream: %+v", upstream)
+	}
+	if upstream.Timeout.Duration() != 90*time.Second {
+		t.Errorf("expected timeout 1m30s, got %s", upstream.Timeout.Duration())
+	}
+}
+
+func TestStrictDecodeJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want []DecodeError
+	}{
+		{
+			name: "valid",
+			data: `{"name": "a", "upstream": {"port": 80, "timeout": "5s"}}`,
+		},
+		{
+			name: "syntax error has a position",
+			data: "{\n  \"name\": \"a\",\n  \"enabled\": tru\n}",
+			want: []DecodeError{{Line: 3, Column: 17, Message: "invalid character '\\n' in literal true (expecting 'e')"}},
+		},
+		{
+			name: "unexpected end of input",
+			data: "{\"name\": \"a\"",
+			want: []DecodeError{{Line: 1, Column: 12, Message: "unexpected end of JSON input"}},
+		},
+		{
+			name: "trailing comma",
+			data: "{\"name\": \"a\",}",
+			want: []DecodeError{{Line: 1, Column: 14, Message: "invalid character '}' looking for beginning of object key string"}},
+		},
+		{
+			name: "unknown field and wrong type are collected",
+			data: "{\n  \"nmae\": \"a\",\n  \"upstream\": {\"port\": \"80\", \"timeout\": 5}\n}",
+			want: []DecodeError{
+				{Line: 2, Column: 3, Path: "$.nmae", Message: `unknown field "nmae"`},
+				{Line: 3, Column: 24, Path: "$.upstream.port", Message: `expected a non-negative integer, got string "80"`},
+				{Line: 3, Column: 41, Path: "$.upstream.timeout", Message: "invalid duration"},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			out := &testConfig{}
+			err := StrictDecodeJSON("config.json", []byte(test.data), out)
+			if len(test.want) == 0 {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("expected %d errors, got none", len(test.want))
+			}
+			got := decodeErrors(t, err)
+			if len(got) != len(test.want) {
+				t.Fatalf("expected %d errors, got %d: %v", len(test.want), len(got), err)
+			}
+			for i, want := range test.want {
+				want.File = "config.json"
+				if *got[i] != want {
+					t.Errorf("error %d: expected %+v, got %+v", i, want, *got[i])
+				}
+			}
+		})
+	}
+}
+
+func TestDecodeErrorString(t *testing.T) {
+	tests := []struct {
+		err  DecodeError
+		want string
+	}{
+		{DecodeError{File: "a.yaml", Message: "document is empty"}, "a.yaml: document is empty"},
+		{DecodeError{File: "a.yaml", Line: 2, Column: 3, Path: "$.x", Message: "bad"}, "a.yaml:2:3: $.x: bad"},
+	}
+	for _, test := range tests {
+		if got := test.err.Error(); got != test.want {
+			t.Errorf("expected %q, got %q", test.want, got)
+		}
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"errors"
 	"time"
+
+	"go.yaml.in/yaml/v3"
 )
 
 type Duration time.Duration
@@ -37,3 +39,20 @@ func (d *Duration) UnmarshalJSON(b []byte) error {
 		return errors.New("invalid duration")
 	}
 }
+
+func (d Duration) MarshalYAML() (interface{}, error) {
+	return time.Duration(d).String(), nil
+}
+
+func (d *Duration) UnmarshalYAML(value *yaml.Node) error {
+	// Only string scalars are accepted, same as in JSON: a bare 5 is ambiguous
+	if value.Kind != yaml.ScalarNode || value.ShortTag() != "!!str" {
+		return errors.New("invalid duration")
+	}
+	tmp, err := time.ParseDuration(value.Value)
+	if err != nil {
+		return err
+	}
+	*d = Duration(tmp)
+	return nil
+}
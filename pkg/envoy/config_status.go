@@ -0,0 +1,103 @@
+package envoy
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/paragor/faraway-edge/pkg/metrics"
+)
+
+// ConfigStatus is the acceptance state of one resource type on one Envoy node.
+type ConfigStatus struct {
+	NodeID        string    `json:"node_id"`
+	NodeCluster   string    `json:"node_cluster"`
+	TypeURL       string    `json:"type_url"`
+	AckedVersion  string    `json:"acked_version,omitempty"`
+	AckedAt       time.Time `json:"acked_at,omitzero"`
+	NackedVersion string    `json:"nacked_version,omitempty"`
+	NackedAt      time.Time `json:"nacked_at,omitzero"`
+	NackError     string    `json:"nack_error,omitempty"`
+	// Rejected is true while the latest version sent to the node is NACKed.
+	Rejected bool `json:"rejected"`
+
+	streamID int64
+}
+
+type configStatusKey struct {
+	nodeID  string
+	typeURL string
+}
+
+// ConfigStatusTracker keeps, for every connected node and type URL, the last
+// version the node ACKed and the last version it NACKed together with the error.
+type ConfigStatusTracker struct {
+	mu       sync.RWMutex
+	statuses map[configStatusKey]*ConfigStatus
+}
+
+func NewConfigStatusTracker() *ConfigStatusTracker {
+	return &ConfigStatusTracker{statuses: map[configStatusKey]*ConfigStatus{}}
+}
+
+func (t *ConfigStatusTracker) get(streamID int64, nodeID, nodeCluster, typeURL string) *ConfigStatus {
+	key := configStatusKey{nodeID: nodeID, typeURL: typeURL}
+	status, ok := t.statuses[key]
+	if !ok {
+		status = &ConfigStatus{NodeID: nodeID, NodeCluster: nodeCluster, TypeURL: typeURL}
+		t.statuses[key] = status
+	}
+	status.streamID = streamID
+	return status
+}
+
+func (t *ConfigStatusTracker) ack(streamID int64, nodeID, nodeCluster, typeURL, version string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	status := t.get(streamID, nodeID, nodeCluster, typeURL)
+	status.AckedVersion = version
+	status.AckedAt = time.Now()
+	status.Rejected = false
+	metrics.XDSConfigRejected.WithLabelValues(nodeID, nodeCluster, typeURL).Set(0)
+}
+
+func (t *ConfigStatusTracker) nack(streamID int64, nodeID, nodeCluster, typeURL, version, message string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	status := t.get(streamID, nodeID, nodeCluster, typeURL)
+	status.NackedVersion = version
+	status.NackedAt = time.Now()
+	status.NackError = message
+	status.Rejected = true
+	metrics.XDSConfigRejected.WithLabelValues(nodeID, nodeCluster, typeURL).Set(1)
+}
+
+// forgetStream drops the statuses last reported on a closed stream.
+func (t *ConfigStatusTracker) forgetStream(streamID int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for key, status := range t.statuses {
+		if status.streamID != streamID {
+			continue
+		}
+		metrics.XDSConfigRejected.DeleteLabelValues(status.NodeID, status.NodeCluster, status.TypeURL)
+		delete(t.statuses, key)
+	}
+}
+
+// Statuses returns a copy of all statuses ordered by node and type URL.
+func (t *ConfigStatusTracker) Statuses() []ConfigStatus {
+	t.mu.RLock()
+	result := make([]ConfigStatus, 0, len(t.statuses))
+	for _, status := range t.statuses {
+		result = append(result, *status)
+	}
+	t.mu.RUnlock()
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].NodeID != result[j].NodeID {
+			return result[i].NodeID < result[j].NodeID
+		}
+		return result[i].TypeURL < result[j].TypeURL
+	})
+	return result
+}
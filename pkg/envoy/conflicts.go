@@ -0,0 +1,306 @@
+package envoy
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/paragor/faraway-edge/pkg/log"
+	"github.com/paragor/faraway-edge/pkg/metrics"
+)
+
+// ConflictPolicy decides what happens when several ingresses claim the same domain.
+type ConflictPolicy string
+
+const (
+	// ConflictRejectAll rejects the whole view, the last good snapshot keeps being served.
+	ConflictRejectAll ConflictPolicy = "reject-all"
+	// ConflictFirstWins keeps the domain of the oldest ingress by creation time.
+	// Ingresses without a creation time, such as static files, count as the oldest.
+	ConflictFirstWins ConflictPolicy = "first-wins"
+	// ConflictProviderPriority keeps the domain of the provider ranked highest,
+	// falling back to first-wins between ingresses of the same provider.
+	ConflictProviderPriority ConflictPolicy = "provider-priority"
+	// ConflictDropBoth drops the domain from every ingress claiming it.
+	ConflictDropBoth ConflictPolicy = "drop-both"
+
+	// precedenceExactOverWildcard is not selectable: an exact domain always
+	// takes precedence over the wildcards of other ingresses matching it.
+	precedenceExactOverWildcard ConflictPolicy = "exact-over-wildcard"
+)
+
+var conflictPolicies = []ConflictPolicy{ConflictRejectAll, ConflictFirstWins, ConflictProviderPriority, ConflictDropBoth}
+
+func ParseConflictPolicy(value string) (ConflictPolicy, error) {
+	policy := ConflictPolicy(value)
+	if !slices.Contains(conflictPolicies, policy) {
+		return "", fmt.Errorf("unknown conflict policy %q, must be one of %v", value, conflictPolicies)
+	}
+	return policy, nil
+}
+
+// ConflictConfig configures how domain conflicts between ingresses are resolved.
+type ConflictConfig struct {
+	Policy ConflictPolicy
+	// ProviderPriority lists provider names, highest priority first. Providers
+	// not listed rank below the listed ones, in the order they are configured.
+	ProviderPriority []string
+}
+
+func (c ConflictConfig) Validate(providers []LogicalClusterProvider) error {
+	errs := validationErrors{}
+	if _, err := ParseConflictPolicy(string(c.Policy)); err != nil {
+		errs.addNested("", err)
+	}
+	for _, name := range c.ProviderPriority {
+		if !slices.ContainsFunc(providers, func(provider LogicalClusterProvider) bool {
+			return provider.Name() == name
+		}) {
+			errs.add("provider priority: unknown provider %q", name)
+		}
+	}
+	return errs.err()
+}
+
+// DomainConflict is a domain claimed by more than one ingress and how it was resolved.
+type DomainConflict struct {
+	Domain string         `json:"domain"`
+	Policy ConflictPolicy `json:"policy"`
+	// Winner is the ingress that kept the domain, empty when none did
+	Winner  string   `json:"winner,omitempty"`
+	Dropped []string `json:"dropped,omitempty"`
+	// Shadowed are the wildcards of other ingresses matching the domain,
+	// which keep serving every other subdomain
+	Shadowed []string `json:"shadowed,omitempty"`
+}
+
+func (c DomainConflict) key() string {
+	return c.Domain + "|" + c.Winner + "|" + strings.Join(c.Dropped, ",") + "|" + strings.Join(c.Shadowed, ",")
+}
+
+// providerClusters are the clusters returned by one provider.
+type providerClusters struct {
+	provider string
+	clusters []*LogicalCluster
+}
+
+// domainClaim is a frontend of an ingress, in the order it appears in the view.
+type domainClaim struct {
+	order    int
+	rank     int
+	cluster  *LogicalCluster
+	ingress  *LogicalClusterIngress
+	frontend *IngressConfig
+}
+
+func (c *domainClaim) describe() string {
+	return c.cluster.describe() + "/" + c.ingress.Name
+}
+
+// conflictResolver drops conflicting domains according to the policy and
+// remembers the conflicts of the last view for the diags server.
+type conflictResolver struct {
+	policy ConflictPolicy
+	// ranks maps provider names to their priority, lower is higher
+	ranks map[string]int
+
+	mu      sync.RWMutex
+	current []DomainConflict
+}
+
+func newConflictResolver(config ConflictConfig, providers []LogicalClusterProvider) *conflictResolver {
+	policy := config.Policy
+	if policy == "" {
+		policy = ConflictRejectAll
+	}
+	ranks := map[string]int{}
+	for i, name := range config.ProviderPriority {
+		ranks[name] = i
+	}
+	for i, provider := range providers {
+		if _, ok := ranks[provider.Name()]; !ok {
+			ranks[provider.Name()] = len(config.ProviderPriority) + i
+		}
+	}
+	return &conflictResolver{policy: policy, ranks: ranks, current: []DomainConflict{}}
+}
+
+// resolve returns the clusters without the frontends losing a conflict, and the
+// conflicts. Clusters and ingresses are copied when changed, never modified.
+// With ConflictRejectAll nothing is dropped and validation reports the duplicates.
+func (r *conflictResolver) resolve(sets []providerClusters) ([]*LogicalCluster, []DomainConflict) {
+	result := []*LogicalCluster{}
+	for _, set := range sets {
+		result = append(result, set.clusters...)
+	}
+	if r.policy == ConflictRejectAll {
+		return result, nil
+	}
+
+	claims := map[string][]*domainClaim{}
+	domains := []string{}
+	order := 0
+	for _, set := range sets {
+		for _, cluster := range set.clusters {
+			if cluster == nil {
+				continue
+			}
+			for _, ingress := range cluster.Ingresses {
+				if ingress == nil {
+					continue
+				}
+				for _, frontend := range ingress.Frontends {
+					if frontend == nil {
+						continue
+					}
+					if _, ok := claims[frontend.Domain]; !ok {
+						domains = append(domains, frontend.Domain)
+					}
+					claims[frontend.Domain] = append(claims[frontend.Domain], &domainClaim{
+						order:    order,
+						rank:     r.ranks[set.provider],
+						cluster:  cluster,
+						ingress:  ingress,
+						frontend: frontend,
+					})
+					order++
+				}
+			}
+		}
+	}
+
+	conflicts := []DomainConflict{}
+	dropped := map[*IngressConfig]struct{}{}
+	for _, domain := range domains {
+		domainClaims := claims[domain]
+		if len(domainClaims) < 2 {
+			continue
+		}
+		conflict := DomainConflict{Domain: domain, Policy: r.policy}
+		losers := domainClaims
+		if r.policy != ConflictDropBoth {
+			sort.SliceStable(domainClaims, func(i, j int) bool {
+				return r.wins(domainClaims[i], domainClaims[j])
+			})
+			conflict.Winner = domainClaims[0].describe()
+			losers = domainClaims[1:]
+		}
+		for _, claim := range losers {
+			dropped[claim.frontend] = struct{}{}
+			conflict.Dropped = append(conflict.Dropped, claim.describe())
+		}
+		conflicts = append(conflicts, conflict)
+	}
+	if len(dropped) == 0 {
+		return result, conflicts
+	}
+
+	for i, cluster := range result {
+		result[i] = withoutFrontends(cluster, dropped)
+	}
+	return result, conflicts
+}
+
+// wins reports whether claim a takes precedence over claim b.
+func (r *conflictResolver) wins(a, b *domainClaim) bool {
+	if r.policy == ConflictProviderPriority && a.rank != b.rank {
+		return a.rank < b.rank
+	}
+	if !a.ingress.CreatedAt.Equal(b.ingress.CreatedAt) {
+		return a.ingress.CreatedAt.Before(b.ingress.CreatedAt)
+	}
+	if a.rank != b.rank {
+		return a.rank < b.rank
+	}
+	return a.order < b.order
+}
+
+// withoutFrontends returns cluster without the dropped frontends. Ingresses
+// left without frontends are removed. cluster is returned as is if unchanged.
+func withoutFrontends(cluster *LogicalCluster, dropped map[*IngressConfig]struct{}) *LogicalCluster {
+	if cluster == nil {
+		return nil
+	}
+	changed := false
+	ingresses := make([]*LogicalClusterIngress, 0, len(cluster.Ingresses))
+	for _, ingress := range cluster.Ingresses {
+		if ingress == nil {
+			ingresses = append(ingresses, ingress)
+			continue
+		}
+		frontends := slices.DeleteFunc(slices.Clone(ingress.Frontends), func(frontend *IngressConfig) bool {
+			_, ok := dropped[frontend]
+			return ok
+		})
+		if len(frontends) == len(ingress.Frontends) {
+			ingresses = append(ingresses, ingress)
+			continue
+		}
+		changed = true
+		if len(frontends) == 0 {
+			continue
+		}
+		ingressCopy := *ingress
+		ingressCopy.Frontends = frontends
+		ingresses = append(ingresses, &ingressCopy)
+	}
+	if !changed {
+		return cluster
+	}
+	clusterCopy := *cluster
+	clusterCopy.Ingresses = ingresses
+	return &clusterCopy
+}
+
+// record publishes the conflicts of the last view and logs the ones not seen before.
+func (r *conflictResolver) record(ctx context.Context, conflicts []DomainConflict) {
+	logger := log.FromContext(ctx)
+	sort.Slice(conflicts, func(i, j int) bool {
+		return conflicts[i].Domain < conflicts[j].Domain
+	})
+
+	r.mu.Lock()
+	previous := map[string]struct{}{}
+	for _, conflict := range r.current {
+		previous[conflict.key()] = struct{}{}
+	}
+	r.current = conflicts
+	r.mu.Unlock()
+
+	dropped, overlaps := 0, 0
+	for _, conflict := range conflicts {
+		dropped += len(conflict.Dropped)
+		if conflict.Policy == precedenceExactOverWildcard {
+			overlaps++
+		}
+		if _, ok := previous[conflict.key()]; ok {
+			continue
+		}
+		if conflict.Policy == precedenceExactOverWildcard {
+			logger.Info("Exact domain takes precedence over wildcards of other ingresses",
+				slog.String("domain", conflict.Domain),
+				slog.String("winner", conflict.Winner),
+				slog.Any("shadowed", conflict.Shadowed))
+			continue
+		}
+		logger.Warn("Domain conflict, dropping domain from ingresses",
+			slog.String("domain", conflict.Domain),
+			slog.String("policy", string(conflict.Policy)),
+			slog.String("winner", conflict.Winner),
+			slog.Any("dropped", conflict.Dropped))
+	}
+	metrics.DomainConflicts.Set(float64(len(conflicts) - overlaps))
+	metrics.DroppedFrontends.Set(float64(dropped))
+	metrics.DomainOverlaps.Set(float64(overlaps))
+}
+
+// Conflicts returns the conflicts resolved in the last view.
+func (r *conflictResolver) Conflicts() []DomainConflict {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return slices.Clone(r.current)
+}
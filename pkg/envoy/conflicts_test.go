@@ -0,0 +1,241 @@
+package envoy
+
+import (
+	"context"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/paragor/faraway-edge/pkg/encodinghelper"
+)
+
+// fakeProvider returns clusters or err, both may be changed between fetches.
+type fakeProvider struct {
+	name     string
+	clusters []*LogicalCluster
+	err      error
+}
+
+func (p *fakeProvider) Name() string {
+	return p.name
+}
+
+func (p *fakeProvider) GetLogicalClusters(ctx context.Context) ([]*LogicalCluster, error) {
+	return p.clusters, p.err
+}
+
+func testIngress(name string, createdAt time.Time, domains ...string) *LogicalClusterIngress {
+	ingress := &LogicalClusterIngress{
+		Name: name,
+		HttpUpstream: &EnvoyUpstreamStaticAddresses{
+			Port:            80,
+			StaticAddresses: []string{"10.0.0.1"},
+			ConnectTimeout:  encodinghelper.NewDuration(time.Second),
+		},
+		HttpsUpstream: &EnvoyUpstreamStaticAddresses{
+			Port:            443,
+			StaticAddresses: []string{"10.0.0.1"},
+			ConnectTimeout:  encodinghelper.NewDuration(time.Second),
+		},
+		CreatedAt: createdAt,
+	}
+	for _, domain := range domains {
+		ingress.Frontends = append(ingress.Frontends, &IngressConfig{Domain: domain})
+	}
+	return ingress
+}
+
+func testCluster(name string, ingresses ...*LogicalClusterIngress) *LogicalCluster {
+	return &LogicalCluster{Name: name, Ingresses: ingresses}
+}
+
+// servedDomains lists every cluster/ingress/domain left in clusters.
+func servedDomains(clusters []*LogicalCluster) []string {
+	result := []string{}
+	for _, cluster := range clusters {
+		for _, ingress := range cluster.Ingresses {
+			for _, frontend := range ingress.Frontends {
+				result = append(result, cluster.Name+"/"+ingress.Name+"/"+frontend.Domain)
+			}
+		}
+	}
+	return result
+}
+
+func TestConflictResolverResolve(t *testing.T) {
+	older := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	newer := older.Add(time.Hour)
+
+	tests := []struct {
+		name     string
+		config   ConflictConfig
+		sets     func() []providerClusters
+		wantKept []string
+		want     []DomainConflict
+	}{
+		{
+			name:   "reject-all keeps every frontend for validation to report",
+			config: ConflictConfig{Policy: ConflictRejectAll},
+			sets: func() []providerClusters {
+				return []providerClusters{
+					{provider: "p1", clusters: []*LogicalCluster{testCluster("a", testIngress("app", newer, "x.com"))}},
+					{provider: "p2", clusters: []*LogicalCluster{testCluster("b", testIngress("app", older, "x.com"))}},
+				}
+			},
+			wantKept: []string{"a/app/x.com", "b/app/x.com"},
+		},
+		{
+			name:   "first-wins keeps the oldest ingress",
+			config: ConflictConfig{Policy: ConflictFirstWins},
+			sets: func() []providerClusters {
+				return []providerClusters{
+					{provider: "p1", clusters: []*LogicalCluster{testCluster("a", testIngress("new", newer, "x.com", "y.com"))}},
+					{provider: "p2", clusters: []*LogicalCluster{testCluster("b", testIngress("old", older, "x.com"))}},
+				}
+			},
+			wantKept: []string{"a/new/y.com", "b/old/x.com"},
+			want: []DomainConflict{
+				{Domain: "x.com", Policy: ConflictFirstWins, Winner: "b/old", Dropped: []string{"a/new"}},
+			},
+		},
+		{
+			name:   "first-wins counts a missing creation time as the oldest",
+			config: ConflictConfig{Policy: ConflictFirstWins},
+			sets: func() []providerClusters {
+				return []providerClusters{
+					{provider: "k8s", clusters: []*LogicalCluster{testCluster("k8s", testIngress("app", older, "x.com"))}},
+					{provider: "static", clusters: []*LogicalCluster{testCluster("static", testIngress("app", time.Time{}, "x.com"))}},
+				}
+			},
+			wantKept: []string{"static/app/x.com"},
+			want: []DomainConflict{
+				{Domain: "x.com", Policy: ConflictFirstWins, Winner: "static/app", Dropped: []string{"k8s/app"}},
+			},
+		},
+		{
+			name:   "first-wins falls back to provider order, then view order",
+			config: ConflictConfig{Policy: ConflictFirstWins},
+			sets: func() []providerClusters {
+				return []providerClusters{
+					{provider: "p1", clusters: []*LogicalCluster{testCluster("a", testIngress("one", older, "x.com"), testIngress("two", older, "x.com"))}},
+					{provider: "p2", clusters: []*LogicalCluster{testCluster("b", testIngress("app", older, "x.com"))}},
+				}
+			},
+			wantKept: []string{"a/one/x.com"},
+			want: []DomainConflict{
+				{Domain: "x.com", Policy: ConflictFirstWins, Winner: "a/one", Dropped: []string{"a/two", "b/app"}},
+			},
+		},
+		{
+			name:   "provider-priority prefers the listed provider over an older ingress",
+			config: ConflictConfig{Policy: ConflictProviderPriority, ProviderPriority: []string{"p2"}},
+			sets: func() []providerClusters {
+				return []providerClusters{
+					{provider: "p1", clusters: []*LogicalCluster{testCluster("a", testIngress("app", older, "x.com"))}},
+					{provider: "p2", clusters: []*LogicalCluster{testCluster("b", testIngress("app", newer, "x.com"))}},
+				}
+			},
+			wantKept: []string{"b/app/x.com"},
+			want: []DomainConflict{
+				{Domain: "x.com", Policy: ConflictProviderPriority, Winner: "b/app", Dropped: []string{"a/app"}},
+			},
+		},
+		{
+			name:   "provider-priority ranks unlisted providers in configured order",
+			config: ConflictConfig{Policy: ConflictProviderPriority, ProviderPriority: []string{"p2"}},
+			sets: func() []providerClusters {
+				return []providerClusters{
+					{provider: "p1", clusters: []*LogicalCluster{testCluster("a", testIngress("app", newer, "x.com"))}},
+					{provider: "p3", clusters: []*LogicalCluster{testCluster("c", testIngress("app", older, "x.com"))}},
+				}
+			},
+			wantKept: []string{"a/app/x.com"},
+			want: []DomainConflict{
+				{Domain: "x.com", Policy: ConflictProviderPriority, Winner: "a/app", Dropped: []string{"c/app"}},
+			},
+		},
+		{
+			name:   "provider-priority uses first-wins within a provider",
+			config: ConflictConfig{Policy: ConflictProviderPriority, ProviderPriority: []string{"p1"}},
+			sets: func() []providerClusters {
+				return []providerClusters{
+					{provider: "p1", clusters: []*LogicalCluster{testCluster("a", testIngress("new", newer, "x.com"), testIngress("old", older, "x.com"))}},
+				}
+			},
+			wantKept: []string{"a/old/x.com"},
+			want: []DomainConflict{
+				{Domain: "x.com", Policy: ConflictProviderPriority, Winner: "a/old", Dropped: []string{"a/new"}},
+			},
+		},
+		{
+			name:   "drop-both drops the domain from every ingress",
+			config: ConflictConfig{Policy: ConflictDropBoth},
+			sets: func() []providerClusters {
+				return []providerClusters{
+					{provider: "p1", clusters: []*LogicalCluster{testCluster("a", testIngress("app", older, "x.com", "y.com"))}},
+					{provider: "p2", clusters: []*LogicalCluster{testCluster("b", testIngress("app", newer, "x.com"))}},
+				}
+			},
+			wantKept: []string{"a/app/y.com"},
+			want: []DomainConflict{
+				{Domain: "x.com", Policy: ConflictDropBoth, Dropped: []string{"a/app", "b/app"}},
+			},
+		},
+		{
+			name:   "wildcards and exact domains are not conflicts",
+			config: ConflictConfig{Policy: ConflictDropBoth},
+			sets: func() []providerClusters {
+				return []providerClusters{
+					{provider: "p1", clusters: []*LogicalCluster{testCluster("a", testIngress("app", older, "*.x.com"))}},
+					{provider: "p2", clusters: []*LogicalCluster{testCluster("b", testIngress("app", newer, "api.x.com"))}},
+				}
+			},
+			wantKept: []string{"a/app/*.x.com", "b/app/api.x.com"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sets := test.sets()
+			providers := []LogicalClusterProvider{}
+			before := []string{}
+			for _, set := range sets {
+				providers = append(providers, &fakeProvider{name: set.provider})
+				before = append(before, servedDomains(set.clusters)...)
+			}
+			resolver := newConflictResolver(test.config, providers)
+
+			clusters, conflicts := resolver.resolve(sets)
+			if got := servedDomains(clusters); !slices.Equal(got, test.wantKept) {
+				t.Errorf("expected served domains %v, got %v", test.wantKept, got)
+			}
+			if len(conflicts) != len(test.want) || (len(conflicts) > 0 && !reflect.DeepEqual(conflicts, test.want)) {
+				t.Errorf("expected conflicts %+v, got %+v", test.want, conflicts)
+			}
+
+			after := []string{}
+			for _, set := range sets {
+				after = append(after, servedDomains(set.clusters)...)
+			}
+			if !slices.Equal(before, after) {
+				t.Errorf("resolve modified its input: %v became %v", before, after)
+			}
+		})
+	}
+}
+
+func TestDomainOverlapsExactOverWildcard(t *testing.T) {
+	clusters := []*LogicalCluster{
+		testCluster("a", testIngress("wild", time.Time{}, "*.x.com", "*.b.x.com")),
+		testCluster("b", testIngress("api", time.Time{}, "api.x.com", "x.com")),
+		testCluster("c", testIngress("deep", time.Time{}, "v1.b.x.com")),
+		testCluster("d", testIngress("own", time.Time{}, "*.y.com", "api.y.com")),
+	}
+	want := []DomainConflict{
+		{Domain: "api.x.com", Policy: precedenceExactOverWildcard, Winner: "b/api", Shadowed: []string{"a/wild (*.x.com)"}},
+		{Domain: "v1.b.x.com", Policy: precedenceExactOverWildcard, Winner: "c/deep", Shadowed: []string{"a/wild (*.x.com)", "a/wild (*.b.x.com)"}},
+	}
+	if got := domainOverlaps(clusters); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected overlaps %+v, got %+v", want, got)
+	}
+}
@@ -0,0 +1,180 @@
+package envoy
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// maxHostnameLength is the RFC 1123 limit of a hostname in its ASCII form
+const maxHostnameLength = 253
+
+// Wildcard domains have the form *.example.com and match every subdomain of
+// example.com at any depth, but not example.com itself, both for HTTP virtual
+// hosts and TLS SNI. When several frontends match a host, the precedence is:
+// an exact domain, then the wildcard with the longest suffix. This is the
+// order Envoy applies, so overlaps are valid and reported, not rejected.
+
+func isWildcardDomain(domain string) bool {
+	return strings.HasPrefix(domain, "*.")
+}
+
+// matchesWildcard reports whether wildcard, such as *.example.com, matches domain.
+func matchesWildcard(wildcard, domain string) bool {
+	suffix := strings.TrimPrefix(wildcard, "*")
+	return len(domain) > len(suffix) && strings.HasSuffix(domain, suffix)
+}
+
+// NormalizeDomain lowercases domain and converts internationalized labels to
+// punycode, the form Envoy compares hosts and SNI in. Wildcards are kept.
+func NormalizeDomain(domain string) (string, error) {
+	prefix := ""
+	if isWildcardDomain(domain) {
+		prefix, domain = "*.", strings.TrimPrefix(domain, "*.")
+	}
+	ascii, err := idna.Lookup.ToASCII(domain)
+	if err != nil {
+		return "", fmt.Errorf("domain %q: %w", prefix+domain, err)
+	}
+	return prefix + strings.ToLower(ascii), nil
+}
+
+// validateDomain checks that domain is a normalized RFC 1123 hostname, optionally a wildcard.
+func validateDomain(domain string) error {
+	hostname := domain
+	if strings.Contains(domain, "*") {
+		if !isWildcardDomain(domain) {
+			return fmt.Errorf("domain %q: a wildcard is only allowed as the whole leftmost label, like *.example.com", domain)
+		}
+		hostname = strings.TrimPrefix(domain, "*.")
+		if strings.Contains(hostname, "*") {
+			return fmt.Errorf("domain %q: only one wildcard is allowed", domain)
+		}
+		if !strings.Contains(hostname, ".") {
+			return fmt.Errorf("domain %q: a wildcard must cover a domain with at least two labels, like *.example.com", domain)
+		}
+	}
+	if normalized, err := NormalizeDomain(domain); err == nil && normalized != domain {
+		return fmt.Errorf("domain %q must be lowercase ASCII, use %q", domain, normalized)
+	}
+	if err := validateHostname(hostname); err != nil {
+		return fmt.Errorf("domain %q: %w", domain, err)
+	}
+	return nil
+}
+
+// validateHostname checks the RFC 1123 syntax of a lowercase ASCII hostname.
+func validateHostname(hostname string) error {
+	if len(hostname) > maxHostnameLength {
+		return fmt.Errorf("longer than %d characters", maxHostnameLength)
+	}
+	for _, label := range strings.Split(hostname, ".") {
+		if label == "" {
+			return fmt.Errorf("empty label")
+		}
+		if len(label) > 63 {
+			return fmt.Errorf("label %q is longer than 63 characters", label)
+		}
+		if label[0] == '-' || label[len(label)-1] == '-' {
+			return fmt.Errorf("label %q starts or ends with a hyphen", label)
+		}
+		for _, char := range label {
+			if (char < 'a' || char > 'z') && (char < '0' || char > '9') && char != '-' {
+				return fmt.Errorf("label %q contains %q, only a-z, 0-9 and - are allowed", label, char)
+			}
+		}
+	}
+	return nil
+}
+
+// normalizeAddress returns IP literals in their canonical form and DNS names normalized.
+// Addresses that cannot be normalized are returned as is and rejected by validation.
+func normalizeAddress(address string) string {
+	if ip, err := netip.ParseAddr(address); err == nil {
+		return ip.String()
+	}
+	if normalized, err := NormalizeDomain(address); err == nil {
+		return normalized
+	}
+	return address
+}
+
+// validateAddress checks that address is an IPv4 or IPv6 literal, or a hostname if allowDNSNames.
+func validateAddress(address string, allowDNSNames bool) error {
+	if ip, err := netip.ParseAddr(address); err == nil {
+		if ip.Zone() != "" {
+			return fmt.Errorf("%q: IPv6 zones are not supported", address)
+		}
+		return nil
+	}
+	if !allowDNSNames {
+		return fmt.Errorf("%q is not an IPv4 or IPv6 address, set type strict_dns or logical_dns to use DNS names", address)
+	}
+	if strings.Contains(address, "*") {
+		return fmt.Errorf("%q: wildcards are not allowed in addresses", address)
+	}
+	if normalized, err := NormalizeDomain(address); err == nil && normalized != address {
+		return fmt.Errorf("%q must be lowercase ASCII, use %q", address, normalized)
+	}
+	if err := validateHostname(address); err != nil {
+		return fmt.Errorf("%q: %w", address, err)
+	}
+	return nil
+}
+
+// isIPAddress reports whether address is an IP literal rather than a DNS name.
+func isIPAddress(address string) bool {
+	_, err := netip.ParseAddr(address)
+	return err == nil
+}
+
+// ownedDomain is a frontend domain together with the ingress it belongs to.
+type ownedDomain struct {
+	domain string
+	owner  string
+}
+
+// domainOverlaps returns every exact domain matched by a wildcard of another
+// ingress. The exact domain takes precedence, the wildcard ingresses are shadowed for it.
+func domainOverlaps(clusters []*LogicalCluster) []DomainConflict {
+	exact := []ownedDomain{}
+	wildcards := []ownedDomain{}
+	for _, cluster := range clusters {
+		if cluster == nil {
+			continue
+		}
+		for _, ingress := range cluster.Ingresses {
+			if ingress == nil {
+				continue
+			}
+			owner := cluster.describe() + "/" + ingress.Name
+			for _, frontend := range ingress.Frontends {
+				if frontend == nil {
+					continue
+				}
+				claim := ownedDomain{domain: frontend.Domain, owner: owner}
+				if isWildcardDomain(frontend.Domain) {
+					wildcards = append(wildcards, claim)
+				} else {
+					exact = append(exact, claim)
+				}
+			}
+		}
+	}
+
+	overlaps := []DomainConflict{}
+	for _, claim := range exact {
+		overlap := DomainConflict{Domain: claim.domain, Policy: precedenceExactOverWildcard, Winner: claim.owner}
+		for _, wildcard := range wildcards {
+			if wildcard.owner != claim.owner && matchesWildcard(wildcard.domain, claim.domain) {
+				overlap.Shadowed = append(overlap.Shadowed, wildcard.owner+" ("+wildcard.domain+")")
+			}
+		}
+		if len(overlap.Shadowed) > 0 {
+			overlaps = append(overlaps, overlap)
+		}
+	}
+	return overlaps
+}
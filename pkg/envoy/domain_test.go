@@ -0,0 +1,237 @@
+package envoy
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/paragor/faraway-edge/pkg/encodinghelper"
+	"golang.org/x/net/idna"
+)
+
+// checkError fails unless err contains wantErr, or is nil when wantErr is empty.
+func checkError(t *testing.T, what string, err error, wantErr string) {
+	t.Helper()
+	switch {
+	case wantErr == "" && err != nil:
+		t.Errorf("%s: unexpected error: %v", what, err)
+	case wantErr != "" && err == nil:
+		t.Errorf("%s: expected an error containing %q", what, wantErr)
+	case wantErr != "" && !strings.Contains(err.Error(), wantErr):
+		t.Errorf("%s: expected an error containing %q, got %v", what, wantErr, err)
+	}
+}
+
+func TestMatchesWildcard(t *testing.T) {
+	tests := []struct {
+		wildcard string
+		domain   string
+		want     bool
+	}{
+		{"*.a.com", "b.a.com", true},
+		{"*.a.com", "x.b.a.com", true},
+		{"*.a.com", "a.com", false},
+		{"*.a.com", "ba.com", false},
+		{"*.a.com", "b.a.com.evil.org", false},
+		{"*.b.a.com", "x.b.a.com", true},
+		{"*.b.a.com", "b.a.com", false},
+		{"*.b.a.com", "x.c.a.com", false},
+		// A wildcard covers every narrower wildcard, Envoy prefers the longest suffix
+		{"*.a.com", "*.b.a.com", true},
+		{"*.b.a.com", "*.a.com", false},
+		{"*.a.com", "*.a.com", true},
+	}
+	for _, test := range tests {
+		if got := matchesWildcard(test.wildcard, test.domain); got != test.want {
+			t.Errorf("matchesWildcard(%q, %q): expected %v, got %v", test.wildcard, test.domain, test.want, got)
+		}
+	}
+}
+
+func TestDomainOverlapsWildcards(t *testing.T) {
+	tests := []struct {
+		name    string
+		domains []string
+		// want are the exact domains reported as taking precedence over a wildcard
+		want []string
+	}{
+		{name: "subdomain", domains: []string{"*.a.com", "b.a.com"}, want: []string{"b.a.com"}},
+		{name: "deep subdomain", domains: []string{"*.a.com", "x.b.a.com"}, want: []string{"x.b.a.com"}},
+		{name: "apex is not matched", domains: []string{"*.a.com", "a.com"}},
+		{name: "wildcard against wildcard is valid", domains: []string{"*.a.com", "*.b.a.com"}},
+		{name: "unrelated", domains: []string{"*.a.com", "b.com"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			clusters := []*LogicalCluster{}
+			for i, domain := range test.domains {
+				clusters = append(clusters, testCluster(string(rune('a'+i)), testIngress("app", time.Time{}, domain)))
+			}
+			got := []string{}
+			for _, overlap := range domainOverlaps(clusters) {
+				got = append(got, overlap.Domain)
+			}
+			if strings.Join(got, ",") != strings.Join(test.want, ",") {
+				t.Errorf("expected overlaps %v, got %v", test.want, got)
+			}
+		})
+	}
+}
+
+func TestValidateDomainWildcards(t *testing.T) {
+	tests := []struct {
+		domain string
+		// wantErr is a substring of the expected error, empty when valid
+		wantErr string
+	}{
+		{domain: "*.a.com"},
+		{domain: "*.b.a.com"},
+		{domain: "*", wantErr: "only allowed as the whole leftmost label"},
+		{domain: "*.com", wantErr: "at least two labels"},
+		{domain: "a.*.com", wantErr: "only allowed as the whole leftmost label"},
+		{domain: "*a.com", wantErr: "only allowed as the whole leftmost label"},
+		{domain: "a*.com", wantErr: "only allowed as the whole leftmost label"},
+		{domain: "*.*.a.com", wantErr: "only one wildcard is allowed"},
+		{domain: "*.a.*.com", wantErr: "only one wildcard is allowed"},
+	}
+	for _, test := range tests {
+		checkError(t, "validateDomain("+test.domain+")", validateDomain(test.domain), test.wantErr)
+	}
+}
+
+func TestNormalizeDomain(t *testing.T) {
+	tests := []struct {
+		domain  string
+		want    string
+		wantErr string
+	}{
+		{domain: "example.com", want: "example.com"},
+		{domain: "API.Example.COM", want: "api.example.com"},
+		{domain: "Bücher.example", want: "xn--bcher-kva.example"},
+		{domain: "xn--bcher-kva.example", want: "xn--bcher-kva.example"},
+		{domain: "*.Bücher.example", want: "*.xn--bcher-kva.example"},
+		{domain: "пример.рф", want: "xn--e1afmkfd.xn--p1ai"},
+		// A trailing dot is kept and rejected by validation, Envoy compares hosts literally
+		{domain: "example.com.", want: "example.com."},
+		{domain: "a_b.com", wantErr: "disallowed rune"},
+		{domain: "a b.com", wantErr: "disallowed rune"},
+		{domain: "xn--zz.com", wantErr: "invalid label"},
+	}
+	for _, test := range tests {
+		got, err := NormalizeDomain(test.domain)
+		checkError(t, "NormalizeDomain("+test.domain+")", err, test.wantErr)
+		if err == nil && got != test.want {
+			t.Errorf("NormalizeDomain(%q): expected %q, got %q", test.domain, test.want, got)
+		}
+	}
+}
+
+func TestNormalizeDomainRoundTrip(t *testing.T) {
+	for _, domain := range []string{"bücher.example", "пример.рф", "münchen.de", "example.com"} {
+		ascii, err := NormalizeDomain(domain)
+		if err != nil {
+			t.Fatalf("NormalizeDomain(%q): unexpected error: %v", domain, err)
+		}
+		if again, err := NormalizeDomain(ascii); err != nil || again != ascii {
+			t.Errorf("NormalizeDomain(%q) is not stable: got %q, %v", ascii, again, err)
+		}
+		if unicode, err := idna.Lookup.ToUnicode(ascii); err != nil || unicode != domain {
+			t.Errorf("ToUnicode(%q): expected %q, got %q, %v", ascii, domain, unicode, err)
+		}
+		if err := validateDomain(ascii); err != nil {
+			t.Errorf("validateDomain(%q): unexpected error: %v", ascii, err)
+		}
+	}
+}
+
+func TestValidateDomain(t *testing.T) {
+	tests := []struct {
+		domain  string
+		wantErr string
+	}{
+		{domain: "example.com"},
+		{domain: "a-b.example.com"},
+		{domain: "xn--bcher-kva.example"},
+		{domain: "localhost"},
+		{domain: strings.Repeat("a", 63) + ".com"},
+		{domain: "Example.com", wantErr: `must be lowercase ASCII, use "example.com"`},
+		{domain: "bücher.example", wantErr: `must be lowercase ASCII, use "xn--bcher-kva.example"`},
+		{domain: "example.com.", wantErr: "empty label"},
+		{domain: "example..com", wantErr: "empty label"},
+		{domain: strings.Repeat("a", 64) + ".com", wantErr: "longer than 63 characters"},
+		{domain: strings.Repeat("abcdefghi.", 26) + "com", wantErr: "longer than 253 characters"},
+		{domain: "-a.com", wantErr: "starts or ends with a hyphen"},
+		{domain: "a-.com", wantErr: "starts or ends with a hyphen"},
+		{domain: "a_b.com", wantErr: `contains '_'`},
+		{domain: "a b.com", wantErr: `contains ' '`},
+		{domain: "a:80", wantErr: `contains ':'`},
+	}
+	for _, test := range tests {
+		checkError(t, "validateDomain("+test.domain+")", validateDomain(test.domain), test.wantErr)
+	}
+}
+
+func TestNormalizeAddress(t *testing.T) {
+	tests := []struct {
+		address string
+		want    string
+	}{
+		{"10.0.0.1", "10.0.0.1"},
+		{"2001:DB8:0:0::0001", "2001:db8::1"},
+		{"::FFFF:10.0.0.1", "::ffff:10.0.0.1"},
+		{"Backend.Example.COM", "backend.example.com"},
+		{"bücher.example", "xn--bcher-kva.example"},
+		{"not an address", "not an address"},
+	}
+	for _, test := range tests {
+		if got := normalizeAddress(test.address); got != test.want {
+			t.Errorf("normalizeAddress(%q): expected %q, got %q", test.address, test.want, got)
+		}
+	}
+}
+
+func TestValidateAddress(t *testing.T) {
+	tests := []struct {
+		address       string
+		allowDNSNames bool
+		wantErr       string
+	}{
+		{address: "10.0.0.1"},
+		{address: "::1"},
+		{address: "2001:db8::1"},
+		{address: "::ffff:10.0.0.1"},
+		{address: "backend.example.com", allowDNSNames: true},
+		{address: "fe80::1%eth0", wantErr: "IPv6 zones are not supported"},
+		{address: "[::1]", wantErr: "is not an IPv4 or IPv6 address"},
+		{address: "10.0.0.256", wantErr: "is not an IPv4 or IPv6 address"},
+		{address: "10.0.0.1:80", wantErr: "is not an IPv4 or IPv6 address"},
+		{address: "[::1]:443", wantErr: "is not an IPv4 or IPv6 address"},
+		{address: "backend.example.com", wantErr: "set type strict_dns or logical_dns"},
+		{address: "backend.example.com:8080", allowDNSNames: true, wantErr: `contains ':'`},
+		{address: "*.example.com", allowDNSNames: true, wantErr: "wildcards are not allowed"},
+		{address: "Backend.example.com", allowDNSNames: true, wantErr: `must be lowercase ASCII, use "backend.example.com"`},
+		{address: "back_end.example.com", allowDNSNames: true, wantErr: `contains '_'`},
+	}
+	for _, test := range tests {
+		checkError(t, "validateAddress("+test.address+")", validateAddress(test.address, test.allowDNSNames), test.wantErr)
+	}
+}
+
+func TestUpstreamPorts(t *testing.T) {
+	tests := []struct {
+		port    uint32
+		wantErr string
+	}{
+		{port: 1},
+		{port: 443},
+		{port: 65535},
+		{port: 0, wantErr: "port is required"},
+		{port: 65536, wantErr: "port must be less than or equal to 65535"},
+	}
+	for _, test := range tests {
+		upstream := &EnvoyUpstreamStaticAddresses{Port: test.port, StaticAddresses: []string{"10.0.0.1"}, ConnectTimeout: encodinghelper.NewDuration(time.Second)}
+		checkError(t, "upstream port", upstream.Validate(), test.wantErr)
+		listener := &ListenerConfig{Name: "http", Protocol: ListenerHTTP, Port: test.port}
+		checkError(t, "listener port", listener.Validate(), test.wantErr)
+	}
+}
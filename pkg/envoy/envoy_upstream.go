@@ -2,59 +2,322 @@ package envoy
 
 import (
 	"fmt"
+	"net/netip"
+	"slices"
+	"time"
 
 	clusterv3 "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
 	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
 	endpointv3 "github.com/envoyproxy/go-control-plane/envoy/config/endpoint/v3"
+	caresv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/network/dns_resolver/cares/v3"
+	proxy_protocolv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/transport_sockets/proxy_protocol/v3"
+	raw_bufferv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/transport_sockets/raw_buffer/v3"
+	"github.com/envoyproxy/go-control-plane/pkg/wellknown"
 	"github.com/paragor/faraway-edge/pkg/encodinghelper"
+	"github.com/paragor/faraway-edge/pkg/utils"
+	"google.golang.org/protobuf/types/known/anypb"
 	"google.golang.org/protobuf/types/known/durationpb"
 )
 
+// UpstreamType decides how Envoy discovers the endpoints of an upstream.
+type UpstreamType string
+
+const (
+	// UpstreamStatic serves IP literals over EDS.
+	UpstreamStatic UpstreamType = "static"
+	// UpstreamStrictDNS resolves every address and balances over all returned IPs.
+	UpstreamStrictDNS UpstreamType = "strict_dns"
+	// UpstreamLogicalDNS connects to the first IP of a single address,
+	// suited for large DNS-balanced services such as cloud load balancers.
+	UpstreamLogicalDNS UpstreamType = "logical_dns"
+)
+
+var upstreamTypes = []UpstreamType{UpstreamStatic, UpstreamStrictDNS, UpstreamLogicalDNS}
+
+// DNSLookupFamily selects the address families Envoy resolves DNS names to.
+type DNSLookupFamily string
+
+const (
+	DNSLookupAuto        DNSLookupFamily = "auto"
+	DNSLookupV4Only      DNSLookupFamily = "v4_only"
+	DNSLookupV6Only      DNSLookupFamily = "v6_only"
+	DNSLookupV4Preferred DNSLookupFamily = "v4_preferred"
+	DNSLookupAll         DNSLookupFamily = "all"
+)
+
+var dnsLookupFamilies = map[DNSLookupFamily]clusterv3.Cluster_DnsLookupFamily{
+	DNSLookupAuto:        clusterv3.Cluster_AUTO,
+	DNSLookupV4Only:      clusterv3.Cluster_V4_ONLY,
+	DNSLookupV6Only:      clusterv3.Cluster_V6_ONLY,
+	DNSLookupV4Preferred: clusterv3.Cluster_V4_PREFERRED,
+	DNSLookupAll:         clusterv3.Cluster_ALL,
+}
+
+// ProxyProtocolVersion is the version of the PROXY protocol header sent to an upstream.
+type ProxyProtocolVersion string
+
+const (
+	ProxyProtocolV1 ProxyProtocolVersion = "v1"
+	ProxyProtocolV2 ProxyProtocolVersion = "v2"
+)
+
+var proxyProtocolVersions = map[ProxyProtocolVersion]corev3.ProxyProtocolConfig_Version{
+	ProxyProtocolV1: corev3.ProxyProtocolConfig_V1,
+	ProxyProtocolV2: corev3.ProxyProtocolConfig_V2,
+}
+
+// minDNSRefreshRate is the lower bound Envoy accepts for a DNS refresh rate, exclusive
+const minDNSRefreshRate = time.Millisecond
+
+// EnvoyUpstreamDNS are the DNS settings of strict_dns and logical_dns upstreams.
+// Unset fields keep the Envoy defaults.
+type EnvoyUpstreamDNS struct {
+	// RefreshRate is how often Envoy resolves the addresses again, 5s by default
+	RefreshRate  encodinghelper.Duration `json:"refresh_rate,omitempty" yaml:"refresh_rate,omitempty"`
+	LookupFamily DNSLookupFamily         `json:"lookup_family,omitempty" yaml:"lookup_family,omitempty"`
+	// Resolvers are nameservers as ip or ip:port used instead of the system ones
+	Resolvers []string `json:"resolvers,omitempty" yaml:"resolvers,omitempty"`
+}
+
+func (d *EnvoyUpstreamDNS) Validate() error {
+	errs := validationErrors{}
+	if d.RefreshRate != 0 && d.RefreshRate.Duration() <= minDNSRefreshRate {
+		errs.add("refresh_rate must be greater than %s", minDNSRefreshRate)
+	}
+	if _, ok := dnsLookupFamilies[d.LookupFamily]; d.LookupFamily != "" && !ok {
+		errs.add("lookup_family %q is unknown, must be one of auto, v4_only, v6_only, v4_preferred or all", d.LookupFamily)
+	}
+	for i, resolver := range d.Resolvers {
+		if _, err := parseResolver(resolver); err != nil {
+			errs.add("resolvers[%d]: %v", i, err)
+		}
+	}
+	return errs.err()
+}
+
+// parseResolver parses a nameserver written as ip or ip:port, the port defaults to 53.
+func parseResolver(resolver string) (netip.AddrPort, error) {
+	if addr, err := netip.ParseAddr(resolver); err == nil {
+		return netip.AddrPortFrom(addr, 53), nil
+	}
+	addrPort, err := netip.ParseAddrPort(resolver)
+	if err != nil {
+		return netip.AddrPort{}, fmt.Errorf("%q is not an ip or ip:port", resolver)
+	}
+	return addrPort, nil
+}
+
+// apply sets the DNS settings on a strict_dns or logical_dns cluster.
+func (d *EnvoyUpstreamDNS) apply(cluster *clusterv3.Cluster) {
+	if d.RefreshRate != 0 {
+		cluster.DnsRefreshRate = durationpb.New(d.RefreshRate.Duration())
+	}
+	if d.LookupFamily != "" {
+		cluster.DnsLookupFamily = dnsLookupFamilies[d.LookupFamily]
+	}
+	if len(d.Resolvers) == 0 {
+		return
+	}
+	resolvers := []*corev3.Address{}
+	for _, resolver := range d.Resolvers {
+		addrPort := utils.Must(parseResolver(resolver))
+		resolvers = append(resolvers, &corev3.Address{
+			Address: &corev3.Address_SocketAddress{
+				SocketAddress: &corev3.SocketAddress{
+					Protocol: corev3.SocketAddress_UDP,
+					Address:  addrPort.Addr().String(),
+					PortSpecifier: &corev3.SocketAddress_PortValue{
+						PortValue: uint32(addrPort.Port()),
+					},
+				},
+			},
+		})
+	}
+	cluster.TypedDnsResolverConfig = &corev3.TypedExtensionConfig{
+		Name:        "envoy.network.dns_resolver.cares",
+		TypedConfig: utils.Must(anypb.New(&caresv3.CaresDnsResolverConfig{Resolvers: resolvers})),
+	}
+}
+
 type EnvoyUpstream interface {
 	GenerateEnvoyCluster(name string) *clusterv3.Cluster
+	// GenerateLoadAssignment returns nil when the cluster is not served over EDS.
+	GenerateLoadAssignment(name string) *endpointv3.ClusterLoadAssignment
 }
 
 type EnvoyUpstreamStaticAddresses struct {
-	Port            uint32                  `json:"port"`
-	StaticAddresses []string                `json:"static_addresses"`
-	ConnectTimeout  encodinghelper.Duration `json:"connect_timeout"`
+	Port            uint32                  `json:"port" yaml:"port"`
+	StaticAddresses []string                `json:"static_addresses" yaml:"static_addresses"`
+	ConnectTimeout  encodinghelper.Duration `json:"connect_timeout" yaml:"connect_timeout"`
+	// Type is static by default, or strict_dns when AllowDNSNames is set and
+	// StaticAddresses contain DNS names. DNS types accept IPs and DNS names.
+	Type UpstreamType `json:"type,omitempty" yaml:"type,omitempty"`
+	// AllowDNSNames accepts DNS names in StaticAddresses without setting Type.
+	AllowDNSNames bool `json:"allow_dns_names,omitempty" yaml:"allow_dns_names,omitempty"`
+	// DNS configures name resolution, only for strict_dns and logical_dns upstreams
+	DNS *EnvoyUpstreamDNS `json:"dns,omitempty" yaml:"dns,omitempty"`
+	// ProxyProtocol sends a PROXY protocol header of this version on every
+	// upstream connection, so the upstream sees the client address. Empty disables it.
+	ProxyProtocol ProxyProtocolVersion `json:"proxy_protocol,omitempty" yaml:"proxy_protocol,omitempty"`
+	// HealthCheck and OutlierDetection take failing addresses out of load balancing, optional
+	HealthCheck      *EnvoyHealthCheck      `json:"health_check,omitempty" yaml:"health_check,omitempty"`
+	OutlierDetection *EnvoyOutlierDetection `json:"outlier_detection,omitempty" yaml:"outlier_detection,omitempty"`
+}
+
+// Normalize canonicalizes IP literals and lowercases and punycodes DNS names.
+func (u *EnvoyUpstreamStaticAddresses) Normalize() {
+	for i, address := range u.StaticAddresses {
+		u.StaticAddresses[i] = normalizeAddress(address)
+	}
+}
+
+// discoveryType returns the Type, defaulting to strict_dns when some address
+// is a DNS name, as EDS only accepts IP literals, and to static otherwise.
+func (u *EnvoyUpstreamStaticAddresses) discoveryType() UpstreamType {
+	if u.Type != "" {
+		return u.Type
+	}
+	if slices.ContainsFunc(u.StaticAddresses, func(address string) bool {
+		return !isIPAddress(address)
+	}) {
+		return UpstreamStrictDNS
+	}
+	return UpstreamStatic
 }
 
 func (u *EnvoyUpstreamStaticAddresses) Validate() error {
+	errs := validationErrors{}
 	if u.Port == 0 {
-		return fmt.Errorf("port is required and must be greater than 0")
+		errs.add("port is required and must be greater than 0")
 	}
 	if u.Port > 65535 {
-		return fmt.Errorf("port must be less than or equal to 65535")
+		errs.add("port must be less than or equal to 65535")
 	}
 	if len(u.StaticAddresses) == 0 {
-		return fmt.Errorf("static_addresses is required and must contain at least one address")
+		errs.add("static_addresses is required and must contain at least one address")
+	}
+	if u.Type != "" && !slices.Contains(upstreamTypes, u.Type) {
+		errs.add("type %q is unknown, must be one of %v", u.Type, upstreamTypes)
+	}
+	dnsType := u.Type == UpstreamStrictDNS || u.Type == UpstreamLogicalDNS
+	if u.Type == UpstreamStatic && u.AllowDNSNames {
+		errs.add("allow_dns_names cannot be used with type static")
 	}
 	for i, addr := range u.StaticAddresses {
 		if addr == "" {
-			return fmt.Errorf("static_addresses[%d] is empty", i)
+			errs.add("static_addresses[%d] is empty", i)
+			continue
+		}
+		if err := validateAddress(addr, u.AllowDNSNames || dnsType); err != nil {
+			errs.add("static_addresses[%d]: %v", i, err)
+		}
+	}
+	// Envoy resolves a logical_dns cluster from exactly one endpoint
+	if u.Type == UpstreamLogicalDNS && len(u.StaticAddresses) > 1 {
+		errs.add("type logical_dns supports exactly one address, got %d", len(u.StaticAddresses))
+	}
+	if u.DNS != nil {
+		if u.discoveryType() == UpstreamStatic {
+			errs.add("dns is only supported by strict_dns and logical_dns upstreams")
 		}
+		errs.addNested("dns", u.DNS.Validate())
+	}
+	if _, ok := proxyProtocolVersions[u.ProxyProtocol]; u.ProxyProtocol != "" && !ok {
+		errs.add("proxy_protocol %q is unknown, must be v1 or v2", u.ProxyProtocol)
+	}
+	if u.HealthCheck != nil {
+		errs.addNested("health_check", u.HealthCheck.Validate())
+	}
+	if u.OutlierDetection != nil {
+		errs.addNested("outlier_detection", u.OutlierDetection.Validate())
 	}
 	if u.ConnectTimeout.Duration() <= 0 {
-		return fmt.Errorf("connect_timeout is required and must be greater than 0")
+		errs.add("connect_timeout is required and must be greater than 0")
 	}
-	return nil
+	return errs.err()
 }
 
+// GenerateEnvoyCluster returns an EDS cluster: endpoints are served separately by
+// GenerateLoadAssignment, so an address change does not touch the cluster itself.
+// DNS upstreams are STRICT_DNS or LOGICAL_DNS clusters with the endpoints inline
+// instead, Envoy resolves them itself.
 func (u *EnvoyUpstreamStaticAddresses) GenerateEnvoyCluster(name string) *clusterv3.Cluster {
+	cluster := u.generateEnvoyCluster(name)
+	cluster.TransportSocket = u.transportSocket()
+	if u.HealthCheck != nil {
+		cluster.HealthChecks = []*corev3.HealthCheck{u.HealthCheck.envoyHealthCheck()}
+	}
+	if u.OutlierDetection != nil {
+		cluster.OutlierDetection = u.OutlierDetection.envoyOutlierDetection()
+	}
+	return cluster
+}
+
+// transportSocket wraps plain connections with a PROXY protocol header, or is nil.
+// Envoy keeps separate upstream connections per client address for it.
+func (u *EnvoyUpstreamStaticAddresses) transportSocket() *corev3.TransportSocket {
+	if u.ProxyProtocol == "" {
+		return nil
+	}
+	return &corev3.TransportSocket{
+		Name: "envoy.transport_sockets.upstream_proxy_protocol",
+		ConfigType: &corev3.TransportSocket_TypedConfig{
+			TypedConfig: utils.Must(anypb.New(&proxy_protocolv3.ProxyProtocolUpstreamTransport{
+				Config: &corev3.ProxyProtocolConfig{Version: proxyProtocolVersions[u.ProxyProtocol]},
+				TransportSocket: &corev3.TransportSocket{
+					Name: wellknown.TransportSocketRawBuffer,
+					ConfigType: &corev3.TransportSocket_TypedConfig{
+						TypedConfig: utils.Must(anypb.New(&raw_bufferv3.RawBuffer{})),
+					},
+				},
+			})),
+		},
+	}
+}
+
+func (u *EnvoyUpstreamStaticAddresses) generateEnvoyCluster(name string) *clusterv3.Cluster {
+	if discoveryType := u.discoveryType(); discoveryType != UpstreamStatic {
+		cluster := &clusterv3.Cluster{
+			Name:           name,
+			ConnectTimeout: durationpb.New(u.ConnectTimeout.Duration()),
+			ClusterDiscoveryType: &clusterv3.Cluster_Type{
+				Type: clusterv3.Cluster_STRICT_DNS,
+			},
+			LoadAssignment: u.loadAssignment(name),
+		}
+		if discoveryType == UpstreamLogicalDNS {
+			cluster.ClusterDiscoveryType = &clusterv3.Cluster_Type{Type: clusterv3.Cluster_LOGICAL_DNS}
+		}
+		if u.DNS != nil {
+			u.DNS.apply(cluster)
+		}
+		return cluster
+	}
 	return &clusterv3.Cluster{
 		Name:           name,
 		ConnectTimeout: durationpb.New(u.ConnectTimeout.Duration()),
 		ClusterDiscoveryType: &clusterv3.Cluster_Type{
-			Type: clusterv3.Cluster_STATIC,
+			Type: clusterv3.Cluster_EDS,
 		},
-		LoadAssignment: &endpointv3.ClusterLoadAssignment{
-			ClusterName: name,
-			Endpoints: []*endpointv3.LocalityLbEndpoints{
-				{LbEndpoints: envoyStaticEndpoints(u.StaticAddresses, u.Port)},
-			},
-			NamedEndpoints: nil,
-			Policy:         nil,
+		EdsClusterConfig: &clusterv3.Cluster_EdsClusterConfig{
+			EdsConfig:   adsConfigSource(),
+			ServiceName: name,
+		},
+	}
+}
+
+func (u *EnvoyUpstreamStaticAddresses) GenerateLoadAssignment(name string) *endpointv3.ClusterLoadAssignment {
+	if u.discoveryType() != UpstreamStatic {
+		return nil
+	}
+	return u.loadAssignment(name)
+}
+
+func (u *EnvoyUpstreamStaticAddresses) loadAssignment(name string) *endpointv3.ClusterLoadAssignment {
+	return &endpointv3.ClusterLoadAssignment{
+		ClusterName: name,
+		Endpoints: []*endpointv3.LocalityLbEndpoints{
+			{LbEndpoints: envoyStaticEndpoints(u.StaticAddresses, u.Port)},
 		},
 	}
 }
@@ -0,0 +1,168 @@
+package envoy
+
+import (
+	clusterv3 "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	endpointv3 "github.com/envoyproxy/go-control-plane/envoy/config/endpoint/v3"
+	listenerv3 "github.com/envoyproxy/go-control-plane/envoy/config/listener/v3"
+	routev3 "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+	tcp_proxyv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/tcp_proxy/v3"
+	"github.com/envoyproxy/go-control-plane/pkg/wellknown"
+	"github.com/paragor/faraway-edge/pkg/utils"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+const (
+	fallbackName             = "fallback"
+	fallbackHttpClusterName  = "fallback.http"
+	fallbackHttpsClusterName = "fallback.https"
+	// maxDirectResponseBody is the default limit of Envoy for inline direct response bodies
+	maxDirectResponseBody = 4096
+)
+
+// FallbackConfig handles traffic for domains no ingress serves, such as a
+// legacy load balancer still serving the domains not migrated yet. Without it
+// unknown hosts get a bare 404 and unknown SNI is dropped by EnvoyBlackhole.
+type FallbackConfig struct {
+	// HttpUpstream receives the requests for unknown hosts
+	HttpUpstream *EnvoyUpstreamStaticAddresses `json:"http_upstream,omitempty" yaml:"http_upstream,omitempty"`
+	// DirectResponse answers the requests for unknown hosts, instead of HttpUpstream
+	DirectResponse *DirectResponse `json:"direct_response,omitempty" yaml:"direct_response,omitempty"`
+	// HttpsUpstream receives the TLS connections with an unknown or no SNI
+	HttpsUpstream *EnvoyUpstreamStaticAddresses `json:"https_upstream,omitempty" yaml:"https_upstream,omitempty"`
+}
+
+// DirectResponse is an HTTP response sent by Envoy itself.
+type DirectResponse struct {
+	Status uint32 `json:"status" yaml:"status"`
+	Body   string `json:"body" yaml:"body"`
+}
+
+func (r *DirectResponse) Validate() error {
+	errs := validationErrors{}
+	if r.Status < 200 || r.Status > 599 {
+		errs.add("status must be between 200 and 599")
+	}
+	if len(r.Body) > maxDirectResponseBody {
+		errs.add("body must be at most %d bytes", maxDirectResponseBody)
+	}
+	return errs.err()
+}
+
+// Normalize normalizes the addresses of the fallback upstreams.
+func (f *FallbackConfig) Normalize() {
+	if f.HttpUpstream != nil {
+		f.HttpUpstream.Normalize()
+	}
+	if f.HttpsUpstream != nil {
+		f.HttpsUpstream.Normalize()
+	}
+}
+
+func (f *FallbackConfig) Validate() error {
+	errs := validationErrors{}
+	if f.HttpUpstream == nil && f.DirectResponse == nil && f.HttpsUpstream == nil {
+		errs.add("at least one of http_upstream, direct_response and https_upstream is required")
+	}
+	if f.HttpUpstream != nil && f.DirectResponse != nil {
+		errs.add("http_upstream and direct_response cannot be combined")
+	}
+	if f.HttpUpstream != nil {
+		errs.addNested("http_upstream", f.HttpUpstream.Validate())
+	}
+	if f.DirectResponse != nil {
+		errs.addNested("direct_response", f.DirectResponse.Validate())
+	}
+	if f.HttpsUpstream != nil {
+		errs.addNested("https_upstream", f.HttpsUpstream.Validate())
+		errs.addNested("https_upstream", validateTLSHealthCheck(f.HttpsUpstream))
+	}
+	return errs.err()
+}
+
+// VirtualHost returns the catch-all virtual host for unknown hosts, or nil.
+// Envoy picks it only when no domain of another virtual host matches.
+func (f *FallbackConfig) VirtualHost() *routev3.VirtualHost {
+	route := &routev3.Route{
+		Name: fallbackName,
+		Match: &routev3.RouteMatch{
+			PathSpecifier: &routev3.RouteMatch_Prefix{Prefix: "/"},
+		},
+		StatPrefix: fallbackHttpClusterName + ".",
+	}
+	switch {
+	case f.HttpUpstream != nil:
+		route.Action = &routev3.Route_Route{
+			Route: &routev3.RouteAction{
+				ClusterSpecifier: &routev3.RouteAction_Cluster{
+					Cluster: fallbackHttpClusterName,
+				},
+			},
+		}
+	case f.DirectResponse != nil:
+		route.Action = &routev3.Route_DirectResponse{
+			DirectResponse: &routev3.DirectResponseAction{
+				Status: f.DirectResponse.Status,
+				Body: &corev3.DataSource{
+					Specifier: &corev3.DataSource_InlineString{InlineString: f.DirectResponse.Body},
+				},
+			},
+		}
+	default:
+		return nil
+	}
+	return &routev3.VirtualHost{
+		Name:    fallbackName,
+		Domains: []string{"*"},
+		Routes:  []*routev3.Route{route},
+	}
+}
+
+// FilterChain returns the default TLS filter chain proxying to HttpsUpstream,
+// or the one of EnvoyBlackhole without it.
+func (f *FallbackConfig) FilterChain() *listenerv3.FilterChain {
+	if f.HttpsUpstream == nil {
+		return envoyBlackhole.GenerateFilterChain()
+	}
+	return &listenerv3.FilterChain{
+		Filters: []*listenerv3.Filter{
+			{
+				Name: wellknown.TCPProxy,
+				ConfigType: &listenerv3.Filter_TypedConfig{
+					TypedConfig: utils.Must(anypb.New(&tcp_proxyv3.TcpProxy{
+						StatPrefix: fallbackHttpsClusterName + ".",
+						ClusterSpecifier: &tcp_proxyv3.TcpProxy_Cluster{
+							Cluster: fallbackHttpsClusterName,
+						},
+					})),
+				},
+			},
+		},
+	}
+}
+
+func (f *FallbackConfig) Clusters() []*clusterv3.Cluster {
+	result := []*clusterv3.Cluster{}
+	if f.HttpUpstream != nil {
+		result = append(result, f.HttpUpstream.GenerateEnvoyCluster(fallbackHttpClusterName))
+	}
+	if f.HttpsUpstream != nil {
+		result = append(result, f.HttpsUpstream.GenerateEnvoyCluster(fallbackHttpsClusterName))
+	}
+	return result
+}
+
+func (f *FallbackConfig) LoadAssignments() []*endpointv3.ClusterLoadAssignment {
+	result := []*endpointv3.ClusterLoadAssignment{}
+	if f.HttpUpstream != nil {
+		if assignment := f.HttpUpstream.GenerateLoadAssignment(fallbackHttpClusterName); assignment != nil {
+			result = append(result, assignment)
+		}
+	}
+	if f.HttpsUpstream != nil {
+		if assignment := f.HttpsUpstream.GenerateLoadAssignment(fallbackHttpsClusterName); assignment != nil {
+			result = append(result, assignment)
+		}
+	}
+	return result
+}
@@ -0,0 +1,163 @@
+package envoy
+
+import (
+	"cmp"
+	"fmt"
+	"strings"
+	"time"
+
+	clusterv3 "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	typev3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+	"github.com/paragor/faraway-edge/pkg/encodinghelper"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// HealthCheckType is the protocol of an active health check.
+type HealthCheckType string
+
+const (
+	// HealthCheckTCP only checks that a connection can be established.
+	HealthCheckTCP HealthCheckType = "tcp"
+	// HealthCheckHTTP sends a plain text HTTP request to the upstream port,
+	// so it is rejected on TLS upstreams, see validateTLSHealthCheck.
+	HealthCheckHTTP HealthCheckType = "http"
+)
+
+const (
+	defaultHealthCheckInterval           = 5 * time.Second
+	defaultHealthCheckTimeout            = time.Second
+	defaultHealthCheckHealthyThreshold   = 2
+	defaultHealthCheckUnhealthyThreshold = 3
+	defaultHealthCheckPath               = "/"
+	defaultHealthCheckExpectedStatus     = 200
+)
+
+// EnvoyHealthCheck is an active health check of every upstream address.
+// Unset fields use the defaults above.
+type EnvoyHealthCheck struct {
+	Type HealthCheckType `json:"type" yaml:"type"`
+	// Path and Host of the HTTP request, / and the upstream cluster name by default
+	Path string `json:"path,omitempty" yaml:"path,omitempty"`
+	Host string `json:"host,omitempty" yaml:"host,omitempty"`
+	// ExpectedStatuses are the HTTP statuses considered healthy, 200 by default
+	ExpectedStatuses []uint32 `json:"expected_statuses,omitempty" yaml:"expected_statuses,omitempty"`
+
+	Interval encodinghelper.Duration `json:"interval,omitempty" yaml:"interval,omitempty"`
+	Timeout  encodinghelper.Duration `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+	// HealthyThreshold and UnhealthyThreshold are the consecutive checks
+	// needed to mark an address healthy or unhealthy
+	HealthyThreshold   uint32 `json:"healthy_threshold,omitempty" yaml:"healthy_threshold,omitempty"`
+	UnhealthyThreshold uint32 `json:"unhealthy_threshold,omitempty" yaml:"unhealthy_threshold,omitempty"`
+}
+
+func (h *EnvoyHealthCheck) Validate() error {
+	errs := validationErrors{}
+	switch h.Type {
+	case HealthCheckTCP:
+		if h.Path != "" || h.Host != "" || len(h.ExpectedStatuses) > 0 {
+			errs.add("path, host and expected_statuses require type %s", HealthCheckHTTP)
+		}
+	case HealthCheckHTTP:
+		if h.Path != "" && !strings.HasPrefix(h.Path, "/") {
+			errs.add("path must start with /")
+		}
+		for i, status := range h.ExpectedStatuses {
+			if status < 100 || status > 599 {
+				errs.add("expected_statuses[%d] must be between 100 and 599", i)
+			}
+		}
+	default:
+		errs.add("type %q is unknown, must be %s or %s", h.Type, HealthCheckTCP, HealthCheckHTTP)
+	}
+	if h.Interval < 0 {
+		errs.add("interval must not be negative")
+	}
+	if h.Timeout < 0 {
+		errs.add("timeout must not be negative")
+	}
+	return errs.err()
+}
+
+// validateTLSHealthCheck rejects health checks an upstream receiving TLS
+// connections cannot answer.
+func validateTLSHealthCheck(upstream *EnvoyUpstreamStaticAddresses) error {
+	if upstream.HealthCheck != nil && upstream.HealthCheck.Type == HealthCheckHTTP {
+		return fmt.Errorf("health_check: type %s sends plain text HTTP and cannot check a TLS upstream, use %s", HealthCheckHTTP, HealthCheckTCP)
+	}
+	return nil
+}
+
+func (h *EnvoyHealthCheck) envoyHealthCheck() *corev3.HealthCheck {
+	result := &corev3.HealthCheck{
+		Interval:           durationpb.New(cmp.Or(h.Interval.Duration(), defaultHealthCheckInterval)),
+		Timeout:            durationpb.New(cmp.Or(h.Timeout.Duration(), defaultHealthCheckTimeout)),
+		HealthyThreshold:   wrapperspb.UInt32(cmp.Or(h.HealthyThreshold, defaultHealthCheckHealthyThreshold)),
+		UnhealthyThreshold: wrapperspb.UInt32(cmp.Or(h.UnhealthyThreshold, defaultHealthCheckUnhealthyThreshold)),
+	}
+	if h.Type == HealthCheckTCP {
+		// Without payloads the check only connects
+		result.HealthChecker = &corev3.HealthCheck_TcpHealthCheck_{TcpHealthCheck: &corev3.HealthCheck_TcpHealthCheck{}}
+		return result
+	}
+	statuses := h.ExpectedStatuses
+	if len(statuses) == 0 {
+		statuses = []uint32{defaultHealthCheckExpectedStatus}
+	}
+	expected := []*typev3.Int64Range{}
+	for _, status := range statuses {
+		expected = append(expected, &typev3.Int64Range{Start: int64(status), End: int64(status) + 1})
+	}
+	result.HealthChecker = &corev3.HealthCheck_HttpHealthCheck_{HttpHealthCheck: &corev3.HealthCheck_HttpHealthCheck{
+		Host:             h.Host,
+		Path:             cmp.Or(h.Path, defaultHealthCheckPath),
+		ExpectedStatuses: expected,
+	}}
+	return result
+}
+
+// EnvoyOutlierDetection ejects addresses failing with consecutive errors
+// from load balancing: 5xx responses for HTTP, connection failures for TLS.
+// Unset fields keep the Envoy defaults.
+type EnvoyOutlierDetection struct {
+	// Consecutive5xx is the number of consecutive errors ejecting an address, 5 by default
+	Consecutive5xx uint32 `json:"consecutive_5xx,omitempty" yaml:"consecutive_5xx,omitempty"`
+	// Interval between ejection sweeps, 10s by default
+	Interval encodinghelper.Duration `json:"interval,omitempty" yaml:"interval,omitempty"`
+	// BaseEjectionTime is multiplied by the number of ejections of the address, 30s by default
+	BaseEjectionTime encodinghelper.Duration `json:"base_ejection_time,omitempty" yaml:"base_ejection_time,omitempty"`
+	// MaxEjectionPercent caps the ejected share of addresses, 10 by default
+	MaxEjectionPercent uint32 `json:"max_ejection_percent,omitempty" yaml:"max_ejection_percent,omitempty"`
+}
+
+func (o *EnvoyOutlierDetection) Validate() error {
+	errs := validationErrors{}
+	if o.Interval < 0 {
+		errs.add("interval must not be negative")
+	}
+	if o.BaseEjectionTime < 0 {
+		errs.add("base_ejection_time must not be negative")
+	}
+	if o.MaxEjectionPercent > 100 {
+		errs.add("max_ejection_percent must be less than or equal to 100")
+	}
+	return errs.err()
+}
+
+func (o *EnvoyOutlierDetection) envoyOutlierDetection() *clusterv3.OutlierDetection {
+	result := &clusterv3.OutlierDetection{}
+	if o.Consecutive5xx != 0 {
+		result.Consecutive_5Xx = wrapperspb.UInt32(o.Consecutive5xx)
+	}
+	if o.Interval != 0 {
+		result.Interval = durationpb.New(o.Interval.Duration())
+	}
+	if o.BaseEjectionTime != 0 {
+		result.BaseEjectionTime = durationpb.New(o.BaseEjectionTime.Duration())
+	}
+	if o.MaxEjectionPercent != 0 {
+		result.MaxEjectionPercent = wrapperspb.UInt32(o.MaxEjectionPercent)
+	}
+	return result
+}
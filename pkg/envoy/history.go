@@ -0,0 +1,107 @@
+package envoy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+)
+
+// historySize is the number of applied views kept for rollback
+const historySize = 20
+
+// HistoryEntry is a logical view that was applied, keyed by the version of the DefaultNodeGroup snapshot.
+type HistoryEntry struct {
+	Version   string    `json:"version"`
+	AppliedAt time.Time `json:"applied_at"`
+	// ChangedProviders are the providers whose clusters differ from the previous entry
+	ChangedProviders []string `json:"changed_providers"`
+	// ProviderVersions is a hash of the clusters returned by every provider
+	ProviderVersions map[string]string `json:"provider_versions"`
+
+	view *LogicalView
+}
+
+// History is the content of the snapshot history as shown on the diags server.
+type History struct {
+	// Pinned is the version updates are frozen at, empty when not pinned
+	Pinned  string         `json:"pinned,omitempty"`
+	Entries []HistoryEntry `json:"entries"`
+}
+
+// snapshotHistory is a bounded ring of applied views, newest last.
+type snapshotHistory struct {
+	mu      sync.RWMutex
+	entries []*HistoryEntry
+}
+
+func (h *snapshotHistory) add(entry *HistoryEntry) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.entries) > 0 {
+		entry.ChangedProviders = changedProviders(h.entries[len(h.entries)-1].ProviderVersions, entry.ProviderVersions)
+	} else {
+		entry.ChangedProviders = changedProviders(nil, entry.ProviderVersions)
+	}
+	// A version that is already known moves to the end, it is the current one again
+	for i, existing := range h.entries {
+		if existing.Version == entry.Version {
+			h.entries = append(h.entries[:i], h.entries[i+1:]...)
+			break
+		}
+	}
+	h.entries = append(h.entries, entry)
+	if len(h.entries) > historySize {
+		h.entries = h.entries[len(h.entries)-historySize:]
+	}
+}
+
+func (h *snapshotHistory) get(version string) (*HistoryEntry, bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for _, entry := range h.entries {
+		if entry.Version == version {
+			return entry, true
+		}
+	}
+	return nil, false
+}
+
+// list returns copies of all entries, newest first.
+func (h *snapshotHistory) list() []HistoryEntry {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	result := make([]HistoryEntry, 0, len(h.entries))
+	for i := len(h.entries) - 1; i >= 0; i-- {
+		result = append(result, *h.entries[i])
+	}
+	return result
+}
+
+func changedProviders(previous, current map[string]string) []string {
+	changed := []string{}
+	for name, version := range current {
+		if previous[name] != version {
+			changed = append(changed, name)
+		}
+	}
+	for name := range previous {
+		if _, ok := current[name]; !ok {
+			changed = append(changed, name)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+// providerVersion hashes the clusters returned by a provider to detect which providers changed.
+func providerVersion(clusters []*LogicalCluster) string {
+	data, err := json.Marshal(clusters)
+	if err != nil {
+		return ""
+	}
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:])
+}
@@ -0,0 +1,214 @@
+package envoy
+
+import (
+	"fmt"
+	"net/netip"
+	"slices"
+
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	listenerv3 "github.com/envoyproxy/go-control-plane/envoy/config/listener/v3"
+	proxy_protocolv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/listener/proxy_protocol/v3"
+	"github.com/envoyproxy/go-control-plane/pkg/wellknown"
+	"github.com/paragor/faraway-edge/pkg/utils"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+// ListenerProtocol decides what a listener serves.
+type ListenerProtocol string
+
+const (
+	// ListenerHTTP serves the HTTP routes of every ingress, matched by Host.
+	ListenerHTTP ListenerProtocol = "http"
+	// ListenerTLS passes TLS through to the HTTPS upstreams, matched by SNI.
+	ListenerTLS ListenerProtocol = "tls"
+)
+
+var listenerProtocols = []ListenerProtocol{ListenerHTTP, ListenerTLS}
+
+// defaultListenerAddress is the bind address of listeners that do not set one
+const defaultListenerAddress = "0.0.0.0"
+
+// ListenerConfig is an Envoy listener of the view. Without configured listeners
+// the view has an HTTP listener on HttpPort and a TLS listener on HttpsPort.
+type ListenerConfig struct {
+	// Name is the Envoy listener name, also used as its stat prefix
+	Name     string           `json:"name" yaml:"name"`
+	Protocol ListenerProtocol `json:"protocol" yaml:"protocol"`
+	Port     uint32           `json:"port" yaml:"port"`
+	// Address is the IP to bind, 0.0.0.0 by default, :: for IPv6
+	Address string `json:"address,omitempty" yaml:"address,omitempty"`
+	// IPv4Compat makes an IPv6 Address such as :: accept IPv4 connections too
+	IPv4Compat bool `json:"ipv4_compat,omitempty" yaml:"ipv4_compat,omitempty"`
+	// AdditionalAddresses are bound on the same port besides Address
+	AdditionalAddresses []string `json:"additional_addresses,omitempty" yaml:"additional_addresses,omitempty"`
+	// ProxyProtocol expects a PROXY protocol v1 or v2 header from an L4 balancer in
+	// front of Envoy and uses its client address. ProxyProtocolOptional also
+	// accepts connections without the header, for migrations.
+	ProxyProtocol         bool `json:"proxy_protocol,omitempty" yaml:"proxy_protocol,omitempty"`
+	ProxyProtocolOptional bool `json:"proxy_protocol_optional,omitempty" yaml:"proxy_protocol_optional,omitempty"`
+
+	// statPrefix overrides Name as stat prefix, kept stable for the default listeners
+	statPrefix string
+}
+
+func (l *ListenerConfig) Validate() error {
+	errs := validationErrors{}
+	if l.Name == "" {
+		errs.add("name is required")
+	}
+	if !slices.Contains(listenerProtocols, l.Protocol) {
+		errs.add("protocol %q is unknown, must be one of %v", l.Protocol, listenerProtocols)
+	}
+	if l.Port == 0 {
+		errs.add("port is required and must be greater than 0")
+	}
+	if l.Port > 65535 {
+		errs.add("port must be less than or equal to 65535")
+	}
+	if l.Address != "" {
+		if err := validateBindAddress(l.Address); err != nil {
+			errs.add("address: %v", err)
+		} else if l.IPv4Compat && !netip.MustParseAddr(l.Address).Is6() {
+			errs.add("ipv4_compat requires an IPv6 address, such as ::")
+		}
+	} else if l.IPv4Compat {
+		errs.add("ipv4_compat requires an IPv6 address, such as ::")
+	}
+	for i, address := range l.AdditionalAddresses {
+		if err := validateBindAddress(address); err != nil {
+			errs.add("additional_addresses[%d]: %v", i, err)
+		}
+	}
+	if l.ProxyProtocolOptional && !l.ProxyProtocol {
+		errs.add("proxy_protocol_optional requires proxy_protocol")
+	}
+	return errs.err()
+}
+
+func validateBindAddress(address string) error {
+	ip, err := netip.ParseAddr(address)
+	if err != nil {
+		return fmt.Errorf("%q is not an IPv4 or IPv6 address", address)
+	}
+	if ip.Zone() != "" {
+		return fmt.Errorf("%q: IPv6 zones are not supported", address)
+	}
+	return nil
+}
+
+// addresses returns every address the listener binds, canonical, Address first.
+func (l *ListenerConfig) addresses() []string {
+	result := []string{defaultListenerAddress}
+	if l.Address != "" {
+		result[0] = l.Address
+	}
+	result = append(result, l.AdditionalAddresses...)
+	for i, address := range result {
+		if ip, err := netip.ParseAddr(address); err == nil {
+			result[i] = ip.String()
+		}
+	}
+	return result
+}
+
+// binds returns every address and port pair the listener receives connections
+// on. A dual-stack IPv6 Address, :: with IPv4Compat, also takes the IPv4 ones,
+// so it collides with 0.0.0.0 on the same port.
+func (l *ListenerConfig) binds() []netip.AddrPort {
+	result := []netip.AddrPort{}
+	for i, address := range l.addresses() {
+		ip := netip.MustParseAddr(address)
+		result = append(result, netip.AddrPortFrom(ip, uint16(l.Port)))
+		if i > 0 || !l.IPv4Compat {
+			continue
+		}
+		switch {
+		case ip.IsUnspecified():
+			result = append(result, netip.AddrPortFrom(netip.IPv4Unspecified(), uint16(l.Port)))
+		case ip.Is4In6():
+			result = append(result, netip.AddrPortFrom(ip.Unmap(), uint16(l.Port)))
+		}
+	}
+	return result
+}
+
+// validateListeners validates every listener and checks that names and bound
+// address and port pairs are unique, see binds.
+func validateListeners(listeners []*ListenerConfig) error {
+	errs := validationErrors{}
+	uniqNames := map[string]struct{}{}
+	uniqBinds := map[netip.AddrPort]string{}
+	for i, listener := range listeners {
+		if listener == nil {
+			errs.add("listeners[%d] is nil", i)
+			continue
+		}
+		prefix := fmt.Sprintf("listeners[%d]", i)
+		err := listener.Validate()
+		errs.addNested(prefix, err)
+		if _, ok := uniqNames[listener.Name]; ok {
+			errs.add("%s: duplicate listener name %q", prefix, listener.Name)
+		}
+		uniqNames[listener.Name] = struct{}{}
+		if err != nil {
+			continue
+		}
+		for _, bind := range listener.binds() {
+			if first, ok := uniqBinds[bind]; ok {
+				errs.add("%s: %s is already bound by listener %q", prefix, bind, first)
+				continue
+			}
+			uniqBinds[bind] = listener.Name
+		}
+	}
+	return errs.err()
+}
+
+// envoyListener returns an Envoy listener binding the addresses of the config
+// with the given listener filters and filter chains. The PROXY protocol filter
+// comes first, it must consume the header before any other filter reads.
+func (l *ListenerConfig) envoyListener(listenerFilters []*listenerv3.ListenerFilter, filterChains []*listenerv3.FilterChain) *listenerv3.Listener {
+	if l.ProxyProtocol {
+		listenerFilters = append([]*listenerv3.ListenerFilter{{
+			Name: wellknown.ProxyProtocol,
+			ConfigType: &listenerv3.ListenerFilter_TypedConfig{
+				TypedConfig: utils.Must(anypb.New(&proxy_protocolv3.ProxyProtocol{
+					AllowRequestsWithoutProxyProtocol: l.ProxyProtocolOptional,
+				})),
+			},
+		}}, listenerFilters...)
+	}
+	addresses := l.addresses()
+	statPrefix := l.Name
+	if l.statPrefix != "" {
+		statPrefix = l.statPrefix
+	}
+	listener := &listenerv3.Listener{
+		Name:            l.Name,
+		Address:         envoySocketAddress(addresses[0], l.Port, l.IPv4Compat),
+		StatPrefix:      statPrefix,
+		ListenerFilters: listenerFilters,
+		FilterChains:    filterChains,
+	}
+	for _, address := range addresses[1:] {
+		listener.AdditionalAddresses = append(listener.AdditionalAddresses, &listenerv3.AdditionalAddress{
+			Address: envoySocketAddress(address, l.Port, false),
+		})
+	}
+	return listener
+}
+
+func envoySocketAddress(address string, port uint32, ipv4Compat bool) *corev3.Address {
+	return &corev3.Address{
+		Address: &corev3.Address_SocketAddress{
+			SocketAddress: &corev3.SocketAddress{
+				Protocol: corev3.SocketAddress_TCP,
+				Address:  address,
+				PortSpecifier: &corev3.SocketAddress_PortValue{
+					PortValue: port,
+				},
+				Ipv4Compat: ipv4Compat,
+			},
+		},
+	}
+}
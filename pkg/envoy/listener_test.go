@@ -0,0 +1,130 @@
+package envoy
+
+import "testing"
+
+func TestValidateListeners(t *testing.T) {
+	tests := []struct {
+		name      string
+		listeners []*ListenerConfig
+		wantErr   string
+	}{
+		{
+			name: "default listeners",
+			listeners: []*ListenerConfig{
+				{Name: "http", Protocol: ListenerHTTP, Port: 80},
+				{Name: "tls", Protocol: ListenerTLS, Port: 443},
+			},
+		},
+		{
+			name: "IPv4 and IPv6-only wildcards on the same port",
+			listeners: []*ListenerConfig{
+				{Name: "v4", Protocol: ListenerHTTP, Port: 80},
+				{Name: "v6", Protocol: ListenerHTTP, Port: 80, Address: "::"},
+			},
+		},
+		{
+			name: "dual-stack on another port",
+			listeners: []*ListenerConfig{
+				{Name: "v4", Protocol: ListenerHTTP, Port: 80},
+				{Name: "dual", Protocol: ListenerTLS, Port: 443, Address: "::", IPv4Compat: true},
+			},
+		},
+		{
+			name: "duplicate name",
+			listeners: []*ListenerConfig{
+				{Name: "http", Protocol: ListenerHTTP, Port: 80},
+				{Name: "http", Protocol: ListenerHTTP, Port: 8080},
+			},
+			wantErr: `listeners[1]: duplicate listener name "http"`,
+		},
+		{
+			name: "same address and port",
+			listeners: []*ListenerConfig{
+				{Name: "a", Protocol: ListenerHTTP, Port: 80},
+				{Name: "b", Protocol: ListenerTLS, Port: 80, Address: "0.0.0.0"},
+			},
+			wantErr: `listeners[1]: 0.0.0.0:80 is already bound by listener "a"`,
+		},
+		{
+			name: "IPv6 spellings of the same address",
+			listeners: []*ListenerConfig{
+				{Name: "a", Protocol: ListenerHTTP, Port: 80, Address: "2001:db8::1"},
+				{Name: "b", Protocol: ListenerHTTP, Port: 80, Address: "2001:DB8:0::0001"},
+			},
+			wantErr: `listeners[1]: [2001:db8::1]:80 is already bound by listener "a"`,
+		},
+		{
+			name: "dual-stack after IPv4 wildcard",
+			listeners: []*ListenerConfig{
+				{Name: "v4", Protocol: ListenerHTTP, Port: 80},
+				{Name: "dual", Protocol: ListenerHTTP, Port: 80, Address: "::", IPv4Compat: true},
+			},
+			wantErr: `listeners[1]: 0.0.0.0:80 is already bound by listener "v4"`,
+		},
+		{
+			name: "IPv4 wildcard after dual-stack",
+			listeners: []*ListenerConfig{
+				{Name: "dual", Protocol: ListenerHTTP, Port: 80, Address: "::", IPv4Compat: true},
+				{Name: "v4", Protocol: ListenerTLS, Port: 80},
+			},
+			wantErr: `listeners[1]: 0.0.0.0:80 is already bound by listener "dual"`,
+		},
+		{
+			name: "dual-stack against additional address",
+			listeners: []*ListenerConfig{
+				{Name: "dual", Protocol: ListenerHTTP, Port: 80, Address: "::", IPv4Compat: true},
+				{Name: "extra", Protocol: ListenerHTTP, Port: 80, Address: "10.0.0.1", AdditionalAddresses: []string{"0.0.0.0"}},
+			},
+			wantErr: `listeners[1]: 0.0.0.0:80 is already bound by listener "dual"`,
+		},
+		{
+			name: "dual-stack and additional address of the same listener",
+			listeners: []*ListenerConfig{
+				{Name: "dual", Protocol: ListenerHTTP, Port: 80, Address: "::", IPv4Compat: true, AdditionalAddresses: []string{"0.0.0.0"}},
+			},
+			wantErr: `listeners[0]: 0.0.0.0:80 is already bound by listener "dual"`,
+		},
+		{
+			name: "additional addresses across listeners",
+			listeners: []*ListenerConfig{
+				{Name: "a", Protocol: ListenerHTTP, Port: 80, Address: "10.0.0.1", AdditionalAddresses: []string{"::1"}},
+				{Name: "b", Protocol: ListenerTLS, Port: 80, Address: "10.0.0.2", AdditionalAddresses: []string{"0:0::1"}},
+			},
+			wantErr: `listeners[1]: [::1]:80 is already bound by listener "a"`,
+		},
+		{
+			name: "mapped IPv4 address with ipv4_compat",
+			listeners: []*ListenerConfig{
+				{Name: "mapped", Protocol: ListenerHTTP, Port: 80, Address: "::ffff:10.0.0.1", IPv4Compat: true},
+				{Name: "v4", Protocol: ListenerHTTP, Port: 80, Address: "10.0.0.1"},
+			},
+			wantErr: `listeners[1]: 10.0.0.1:80 is already bound by listener "mapped"`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := validateListeners(test.listeners)
+			if test.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != test.wantErr {
+				t.Fatalf("expected error %q, got %v", test.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestLogicalViewValidateListenerPorts(t *testing.T) {
+	view := &LogicalView{HttpPort: 443, HttpsPort: 443}
+	if err := view.validateListeners(); err == nil {
+		t.Fatalf("expected default listeners on the same port to be rejected")
+	}
+	group := &NodeGroup{Name: "g", HttpPort: 443}
+	config := &ViewConfig{NodeGroups: []*NodeGroup{group}}
+	if err := config.Validate(); err == nil {
+		t.Fatalf("expected a node group moving http_port to 443 to be rejected")
+	}
+}
@@ -4,42 +4,77 @@ import (
 	"fmt"
 
 	clusterv3 "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
+	endpointv3 "github.com/envoyproxy/go-control-plane/envoy/config/endpoint/v3"
 	listenerv3 "github.com/envoyproxy/go-control-plane/envoy/config/listener/v3"
 	routev3 "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
 )
 
 type LogicalCluster struct {
-	Name      string                   `json:"name"`
-	Ingresses []*LogicalClusterIngress `json:"ingresses"`
+	Name      string                   `json:"name" yaml:"name"`
+	Ingresses []*LogicalClusterIngress `json:"ingresses" yaml:"ingresses"`
+
+	// Source describes where the cluster was loaded from (file path, k8s)
+	// and is only used to make validation errors point at the culprit.
+	Source string `json:"-" yaml:"-"`
+}
+
+func (c *LogicalCluster) describe() string {
+	switch {
+	case c.Source == "":
+		return c.Name
+	case c.Name == "":
+		return "(" + c.Source + ")"
+	}
+	return c.Name + " (" + c.Source + ")"
+}
+
+// Normalize normalizes the domains and upstream addresses of every ingress,
+// see LogicalClusterIngress.Normalize. Loaders call it before Validate.
+func (c *LogicalCluster) Normalize() {
+	for _, ingress := range c.Ingresses {
+		if ingress != nil {
+			ingress.Normalize()
+		}
+	}
 }
 
 func (c *LogicalCluster) Validate() error {
+	errs := validationErrors{}
 	if c.Name == "" {
-		return fmt.Errorf("cluster name is required")
+		if c.Source != "" {
+			errs.add("%s: cluster name is required", c.Source)
+		} else {
+			errs.add("cluster name is required")
+		}
 	}
 	for i, ingress := range c.Ingresses {
 		if ingress == nil {
-			return fmt.Errorf("cluster %q: ingresses[%d] is nil", c.Name, i)
-		}
-		if err := ingress.Validate(); err != nil {
-			return fmt.Errorf("cluster %q: ingresses[%d]: %w", c.Name, i, err)
+			errs.add("cluster %q: ingresses[%d] is nil", c.describe(), i)
+			continue
 		}
+		errs.addNested(fmt.Sprintf("cluster %q: ingresses[%d]", c.describe(), i), ingress.Validate())
 	}
-	return nil
+	return errs.err()
 }
 
-func (c *LogicalCluster) TLSFilters() []*listenerv3.FilterChain {
+// TLSFilters returns the filter chains of the ingresses served on listener.
+func (c *LogicalCluster) TLSFilters(listener *ListenerConfig) []*listenerv3.FilterChain {
 	result := []*listenerv3.FilterChain{}
 	for _, upstream := range c.Ingresses {
-		result = append(result, upstream.TLSFilter(c.Name))
+		if upstream.servedOn(listener) {
+			result = append(result, upstream.TLSFilter(c.Name))
+		}
 	}
 	return result
 }
 
-func (c *LogicalCluster) VirtualHosts() []*routev3.VirtualHost {
+// VirtualHosts returns the virtual hosts of the ingresses served on listener.
+func (c *LogicalCluster) VirtualHosts(listener *ListenerConfig) []*routev3.VirtualHost {
 	result := []*routev3.VirtualHost{}
 	for _, upstream := range c.Ingresses {
-		result = append(result, upstream.VirtualHost(c.Name))
+		if upstream.servedOn(listener) {
+			result = append(result, upstream.VirtualHost(c.Name))
+		}
 	}
 	return result
 }
@@ -51,3 +86,11 @@ func (c *LogicalCluster) Clusters() []*clusterv3.Cluster {
 	}
 	return result
 }
+
+func (c *LogicalCluster) LoadAssignments() []*endpointv3.ClusterLoadAssignment {
+	result := []*endpointv3.ClusterLoadAssignment{}
+	for _, upstream := range c.Ingresses {
+		result = append(result, upstream.LoadAssignments(c.Name)...)
+	}
+	return result
+}
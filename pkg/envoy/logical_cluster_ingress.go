@@ -2,86 +2,203 @@ package envoy
 
 import (
 	"fmt"
+	"slices"
+	"time"
 
 	clusterv3 "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
+	endpointv3 "github.com/envoyproxy/go-control-plane/envoy/config/endpoint/v3"
 	listenerv3 "github.com/envoyproxy/go-control-plane/envoy/config/listener/v3"
 	routev3 "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
 )
 
+// HttpMode decides how an ingress serves plain HTTP.
+type HttpMode string
+
+const (
+	// HttpModeProxy proxies plain HTTP to HttpUpstream.
+	HttpModeProxy HttpMode = "proxy"
+	// HttpModeRedirect redirects plain HTTP to HTTPS at the edge, HttpUpstream is not used.
+	HttpModeRedirect HttpMode = "redirect"
+	// HttpModeDisabled answers plain HTTP with 404, HttpUpstream is not used.
+	HttpModeDisabled HttpMode = "disabled"
+)
+
+var httpModes = []HttpMode{HttpModeProxy, HttpModeRedirect, HttpModeDisabled}
+
+// defaultHttpRedirectCode is the status of HTTPS redirects without HttpRedirectCode
+const defaultHttpRedirectCode = 301
+
+var httpRedirectCodes = map[uint32]routev3.RedirectAction_RedirectResponseCode{
+	301: routev3.RedirectAction_MOVED_PERMANENTLY,
+	302: routev3.RedirectAction_FOUND,
+	303: routev3.RedirectAction_SEE_OTHER,
+	307: routev3.RedirectAction_TEMPORARY_REDIRECT,
+	308: routev3.RedirectAction_PERMANENT_REDIRECT,
+}
+
 type IngressConfig struct {
-	Domain string `json:"domain"`
+	Domain string `json:"domain" yaml:"domain"`
+}
+
+// Normalize lowercases the domain and converts it to punycode. A domain that
+// cannot be normalized is kept as is and reported by Validate.
+func (ic *IngressConfig) Normalize() {
+	if normalized, err := NormalizeDomain(ic.Domain); err == nil {
+		ic.Domain = normalized
+	}
 }
 
 func (ic *IngressConfig) Validate() error {
 	if ic.Domain == "" {
 		return fmt.Errorf("domain is required")
 	}
-	return nil
+	return validateDomain(ic.Domain)
 }
 
 type LogicalClusterIngress struct {
-	Name          string                        `json:"name"`
-	HttpUpstream  *EnvoyUpstreamStaticAddresses `json:"http_upstream"`
-	HttpsUpstream *EnvoyUpstreamStaticAddresses `json:"https_upstream"`
+	Name          string                        `json:"name" yaml:"name"`
+	HttpUpstream  *EnvoyUpstreamStaticAddresses `json:"http_upstream" yaml:"http_upstream"`
+	HttpsUpstream *EnvoyUpstreamStaticAddresses `json:"https_upstream" yaml:"https_upstream"`
+	// HttpMode is proxy by default, the only mode requiring HttpUpstream
+	HttpMode HttpMode `json:"http_mode,omitempty" yaml:"http_mode,omitempty"`
+	// HttpRedirectCode is the status of redirects: 301 (default), 302, 303, 307 or 308
+	HttpRedirectCode uint32 `json:"http_redirect_code,omitempty" yaml:"http_redirect_code,omitempty"`
+	// ListenerProxyProtocol serves the ingress only on listeners accepting a PROXY
+	// protocol header when true, or only on listeners accepting connections without
+	// one when false. Unset serves it on every listener.
+	ListenerProxyProtocol *bool `json:"listener_proxy_protocol,omitempty" yaml:"listener_proxy_protocol,omitempty"`
+
+	Frontends []*IngressConfig `json:"frontends" yaml:"frontends"`
+
+	// CreatedAt is when the ingress was created at its source, if known.
+	// The first-wins conflict policy keeps the domain of the oldest ingress.
+	CreatedAt time.Time `json:"-" yaml:"-"`
+}
+
+// Normalize normalizes the domains and upstream addresses of the ingress.
+func (li *LogicalClusterIngress) Normalize() {
+	for _, frontend := range li.Frontends {
+		if frontend != nil {
+			frontend.Normalize()
+		}
+	}
+	if li.HttpUpstream != nil {
+		li.HttpUpstream.Normalize()
+	}
+	if li.HttpsUpstream != nil {
+		li.HttpsUpstream.Normalize()
+	}
+}
 
-	Frontends []*IngressConfig `json:"frontends"`
+// servedOn reports whether the listener serves the ingress, see ListenerProxyProtocol.
+func (li *LogicalClusterIngress) servedOn(listener *ListenerConfig) bool {
+	switch {
+	case li.ListenerProxyProtocol == nil:
+		return true
+	case *li.ListenerProxyProtocol:
+		return listener.ProxyProtocol
+	default:
+		return !listener.ProxyProtocol || listener.ProxyProtocolOptional
+	}
 }
 
 func (li *LogicalClusterIngress) Validate() error {
+	errs := validationErrors{}
 	if li.Name == "" {
-		return fmt.Errorf("ingress name is required")
+		errs.add("ingress name is required")
 	}
-	if li.HttpUpstream == nil {
-		return fmt.Errorf("ingress %q: http_upstream is required", li.Name)
+	if li.HttpMode != "" && !slices.Contains(httpModes, li.HttpMode) {
+		errs.add("ingress %q: http_mode %q is unknown, must be one of %v", li.Name, li.HttpMode, httpModes)
 	}
-	if err := li.HttpUpstream.Validate(); err != nil {
-		return fmt.Errorf("ingress %q: http_upstream: %w", li.Name, err)
+	if li.HttpRedirectCode != 0 {
+		if li.httpMode() != HttpModeRedirect {
+			errs.add("ingress %q: http_redirect_code requires http_mode %s", li.Name, HttpModeRedirect)
+		} else if _, ok := httpRedirectCodes[li.HttpRedirectCode]; !ok {
+			errs.add("ingress %q: http_redirect_code must be one of 301, 302, 303, 307 or 308", li.Name)
+		}
 	}
-	if li.HttpsUpstream == nil {
-		return fmt.Errorf("ingress %q: https_upstream is required", li.Name)
+	if li.HttpUpstream == nil {
+		if li.httpMode() == HttpModeProxy {
+			errs.add("ingress %q: http_upstream is required in http_mode %s", li.Name, HttpModeProxy)
+		}
+	} else {
+		errs.addNested(fmt.Sprintf("ingress %q: http_upstream", li.Name), li.HttpUpstream.Validate())
 	}
-	if err := li.HttpsUpstream.Validate(); err != nil {
-		return fmt.Errorf("ingress %q: https_upstream: %w", li.Name, err)
+	if li.HttpsUpstream == nil {
+		errs.add("ingress %q: https_upstream is required", li.Name)
+	} else {
+		errs.addNested(fmt.Sprintf("ingress %q: https_upstream", li.Name), li.HttpsUpstream.Validate())
+		errs.addNested(fmt.Sprintf("ingress %q: https_upstream", li.Name), validateTLSHealthCheck(li.HttpsUpstream))
 	}
 	if len(li.Frontends) == 0 {
-		return fmt.Errorf("ingress %q: frontends is required and must contain at least one frontend", li.Name)
+		errs.add("ingress %q: frontends is required and must contain at least one frontend", li.Name)
 	}
+	uniqDomains := map[string]int{}
 	for i, frontend := range li.Frontends {
 		if frontend == nil {
-			return fmt.Errorf("ingress %q: frontends[%d] is nil", li.Name, i)
+			errs.add("ingress %q: frontends[%d] is nil", li.Name, i)
+			continue
 		}
-		if err := frontend.Validate(); err != nil {
-			return fmt.Errorf("ingress %q: frontends[%d]: %w", li.Name, i, err)
+		errs.addNested(fmt.Sprintf("ingress %q: frontends[%d]", li.Name, i), frontend.Validate())
+		if first, ok := uniqDomains[frontend.Domain]; ok {
+			errs.add("ingress %q: frontends[%d]: duplicate domain %q, already in frontends[%d]", li.Name, i, frontend.Domain, first)
+			continue
 		}
+		uniqDomains[frontend.Domain] = i
+	}
+	return errs.err()
+}
+
+func (li *LogicalClusterIngress) httpMode() HttpMode {
+	if li.HttpMode == "" {
+		return HttpModeProxy
 	}
-	return nil
+	return li.HttpMode
 }
 
+// VirtualHost returns the virtual host of the frontends. Without routes, in
+// disabled mode, Envoy answers 404 instead of falling back to another virtual host.
 func (li *LogicalClusterIngress) VirtualHost(logicalClusterName string) *routev3.VirtualHost {
 	upstreamClusterName := li.getHttpClusterName(logicalClusterName)
 	domains := []string{}
 	for _, front := range li.Frontends {
 		domains = append(domains, front.Domain)
 	}
+	route := &routev3.Route{
+		Name: upstreamClusterName,
+		Match: &routev3.RouteMatch{
+			PathSpecifier: &routev3.RouteMatch_Prefix{Prefix: "/"},
+		},
+		StatPrefix: upstreamClusterName + ".",
+	}
+	routes := []*routev3.Route{route}
+	switch li.httpMode() {
+	case HttpModeProxy:
+		route.Action = &routev3.Route_Route{
+			Route: &routev3.RouteAction{
+				ClusterSpecifier: &routev3.RouteAction_Cluster{
+					Cluster: upstreamClusterName,
+				},
+			},
+		}
+	case HttpModeRedirect:
+		code := li.HttpRedirectCode
+		if code == 0 {
+			code = defaultHttpRedirectCode
+		}
+		route.Action = &routev3.Route_Redirect{
+			Redirect: &routev3.RedirectAction{
+				SchemeRewriteSpecifier: &routev3.RedirectAction_HttpsRedirect{HttpsRedirect: true},
+				ResponseCode:           httpRedirectCodes[code],
+			},
+		}
+	case HttpModeDisabled:
+		routes = []*routev3.Route{}
+	}
 	return &routev3.VirtualHost{
 		Name:    upstreamClusterName,
 		Domains: domains,
-		Routes: []*routev3.Route{
-			{
-				Name: upstreamClusterName,
-				Match: &routev3.RouteMatch{
-					PathSpecifier: &routev3.RouteMatch_Prefix{Prefix: "/"},
-				},
-				Action: &routev3.Route_Route{
-					Route: &routev3.RouteAction{
-						ClusterSpecifier: &routev3.RouteAction_Cluster{
-							Cluster: upstreamClusterName,
-						},
-					},
-				},
-				StatPrefix: upstreamClusterName + ".",
-			},
-		},
+		Routes:  routes,
 	}
 }
 
@@ -98,11 +215,29 @@ func (li *LogicalClusterIngress) TLSFilter(logicalClusterName string) *listenerv
 	return filter.GenerateFilterChain()
 }
 
+// Clusters returns the upstream clusters, without the HTTP one unless in proxy mode.
 func (li *LogicalClusterIngress) Clusters(logicalClusterName string) []*clusterv3.Cluster {
-	return []*clusterv3.Cluster{
-		li.HttpUpstream.GenerateEnvoyCluster(li.getHttpClusterName(logicalClusterName)),
-		li.HttpsUpstream.GenerateEnvoyCluster(li.getHttpsClusterName(logicalClusterName)),
+	result := []*clusterv3.Cluster{}
+	if li.httpMode() == HttpModeProxy {
+		result = append(result, li.HttpUpstream.GenerateEnvoyCluster(li.getHttpClusterName(logicalClusterName)))
+	}
+	return append(result, li.HttpsUpstream.GenerateEnvoyCluster(li.getHttpsClusterName(logicalClusterName)))
+}
+
+// LoadAssignments returns the EDS endpoints of the clusters served over EDS.
+func (li *LogicalClusterIngress) LoadAssignments(logicalClusterName string) []*endpointv3.ClusterLoadAssignment {
+	assignments := []*endpointv3.ClusterLoadAssignment{}
+	if li.httpMode() == HttpModeProxy {
+		assignments = append(assignments, li.HttpUpstream.GenerateLoadAssignment(li.getHttpClusterName(logicalClusterName)))
+	}
+	assignments = append(assignments, li.HttpsUpstream.GenerateLoadAssignment(li.getHttpsClusterName(logicalClusterName)))
+	result := []*endpointv3.ClusterLoadAssignment{}
+	for _, assignment := range assignments {
+		if assignment != nil {
+			result = append(result, assignment)
+		}
 	}
+	return result
 }
 
 func (li *LogicalClusterIngress) getHttpClusterName(logicalClusterName string) string {
@@ -2,74 +2,189 @@ package envoy
 
 import (
 	"fmt"
+	"slices"
 
 	clusterv3 "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
-	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	endpointv3 "github.com/envoyproxy/go-control-plane/envoy/config/endpoint/v3"
 	listenerv3 "github.com/envoyproxy/go-control-plane/envoy/config/listener/v3"
 	routev3 "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
 	routerv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/router/v3"
 	tls_inspectorv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/listener/tls_inspector/v3"
 	http_connection_managerv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"
 	"github.com/envoyproxy/go-control-plane/pkg/wellknown"
+	"github.com/paragor/faraway-edge/pkg/metrics"
 	"github.com/paragor/faraway-edge/pkg/utils"
 	"google.golang.org/protobuf/types/known/anypb"
 )
 
+const httpRouteConfigName = "http_routes"
+
 type LogicalView struct {
-	LogicalClusters []*LogicalCluster `json:"logical_clusters"`
-	HttpPort        uint32            `json:"http_port"`
-	HttpsPort       uint32            `json:"https_port"`
+	LogicalClusters []*LogicalCluster `json:"logical_clusters" yaml:"logical_clusters"`
+	HttpPort        uint32            `json:"http_port" yaml:"http_port"`
+	HttpsPort       uint32            `json:"https_port" yaml:"https_port"`
+	// ListenerConfigs replace the default listeners on HttpPort and HttpsPort when set
+	ListenerConfigs []*ListenerConfig `json:"listeners,omitempty" yaml:"listeners,omitempty"`
+	// Fallback handles unknown hosts and SNI, optional
+	Fallback *FallbackConfig `json:"fallback,omitempty" yaml:"fallback,omitempty"`
+
+	// providerVersions is a hash of the clusters of every provider the view was taken from
+	providerVersions map[string]string
 }
 
 func (v *LogicalView) Validate() error {
+	errs := validationErrors{}
+	errs.addNested("", v.validateListeners())
+	if v.Fallback != nil {
+		errs.addNested("fallback", v.Fallback.Validate())
+	}
+	if len(v.LogicalClusters) == 0 {
+		errs.add("logical_clusters is required and must contain at least one cluster")
+	}
+	errs.addNested("", ValidateLogicalClusters(v.LogicalClusters))
+	return errs.err()
+}
+
+// validateListeners validates the configured listeners, or the ports of the
+// default listeners, which must not bind the same port.
+func (v *LogicalView) validateListeners() error {
+	if len(v.ListenerConfigs) > 0 {
+		return validateListeners(v.ListenerConfigs)
+	}
+	errs := validationErrors{}
 	if v.HttpPort == 0 {
-		return fmt.Errorf("http_port is required and must be greater than 0")
+		errs.add("http_port is required and must be greater than 0")
 	}
 	if v.HttpPort > 65535 {
-		return fmt.Errorf("http_port must be less than or equal to 65535")
+		errs.add("http_port must be less than or equal to 65535")
 	}
 	if v.HttpsPort == 0 {
-		return fmt.Errorf("https_port is required and must be greater than 0")
+		errs.add("https_port is required and must be greater than 0")
 	}
 	if v.HttpsPort > 65535 {
-		return fmt.Errorf("https_port must be less than or equal to 65535")
-	}
-	if len(v.LogicalClusters) == 0 {
-		return fmt.Errorf("logical_clusters is required and must contain at least one cluster")
+		errs.add("https_port must be less than or equal to 65535")
 	}
-	for i, cluster := range v.LogicalClusters {
-		if cluster == nil {
-			return fmt.Errorf("logical_clusters[%d] is nil", i)
-		}
-		if err := cluster.Validate(); err != nil {
-			return fmt.Errorf("logical_clusters[%d]: %w", i, err)
-		}
+	if v.HttpPort != 0 && v.HttpPort == v.HttpsPort {
+		errs.add("http_port and https_port must differ, both are %d", v.HttpPort)
 	}
+	return errs.err()
+}
+
+// ValidateLogicalClusters validates every cluster and checks that cluster names
+// and domains are unique across the whole set. A wildcard and an exact domain
+// it matches are not duplicates, see DomainOverlaps.
+func ValidateLogicalClusters(clusters []*LogicalCluster) error {
+	errs := validationErrors{}
+	valid := validateLogicalClusterNames(clusters, &errs)
 	uniqHttpDomain := map[string]string{}
-	for _, cluster := range v.LogicalClusters {
+	for _, cluster := range valid {
 		for _, ingress := range cluster.Ingresses {
+			if ingress == nil {
+				continue
+			}
 			for _, config := range ingress.Frontends {
-				fullName := cluster.Name + "/" + ingress.Name + "/" + config.Domain
-				if secondName, ok := uniqHttpDomain[config.Domain]; ok {
-					return fmt.Errorf(
+				if config == nil {
+					continue
+				}
+				fullName := cluster.describe() + "/" + ingress.Name + "/" + config.Domain
+				if firstName, ok := uniqHttpDomain[config.Domain]; ok {
+					// Duplicates inside one ingress are reported by the ingress itself
+					if firstName == fullName {
+						continue
+					}
+					errs.add(
 						"duplicate domain name: %s. first cluster: %s, second cluster: %s",
 						config.Domain,
+						firstName,
 						fullName,
-						secondName,
 					)
+					continue
 				}
 				uniqHttpDomain[config.Domain] = fullName
 			}
 		}
 	}
-	return nil
+	return errs.err()
+}
+
+// ValidateLogicalClusterNames validates every cluster and checks that cluster
+// names are unique. Unlike ValidateLogicalClusters it allows domain conflicts,
+// which are left to the conflict policy of the view.
+func ValidateLogicalClusterNames(clusters []*LogicalCluster) error {
+	errs := validationErrors{}
+	validateLogicalClusterNames(clusters, &errs)
+	return errs.err()
+}
+
+// validateLogicalClusterNames adds the problems of every cluster and of
+// duplicate cluster names to errs and returns the non-nil clusters.
+func validateLogicalClusterNames(clusters []*LogicalCluster, errs *validationErrors) []*LogicalCluster {
+	valid := make([]*LogicalCluster, 0, len(clusters))
+	for i, cluster := range clusters {
+		if cluster == nil {
+			errs.add("logical_clusters[%d] is nil", i)
+			continue
+		}
+		errs.addNested(fmt.Sprintf("logical_clusters[%d]", i), cluster.Validate())
+		valid = append(valid, cluster)
+	}
+	uniqClusterName := map[string]string{}
+	for _, cluster := range valid {
+		if firstName, ok := uniqClusterName[cluster.Name]; ok {
+			errs.add(
+				"duplicate cluster name: %s. first cluster: %s, second cluster: %s",
+				cluster.Name,
+				firstName,
+				cluster.describe(),
+			)
+			continue
+		}
+		uniqClusterName[cluster.Name] = cluster.describe()
+	}
+	return valid
+}
+
+// DomainOverlaps returns the exact domains also matched by a wildcard of another
+// ingress. They are valid: the exact domain takes precedence for that host.
+func (v *LogicalView) DomainOverlaps() []DomainConflict {
+	return domainOverlaps(v.LogicalClusters)
+}
+
+func (s *LogicalView) recordMetrics() {
+	ingresses, domains := 0, 0
+	for _, cluster := range s.LogicalClusters {
+		ingresses += len(cluster.Ingresses)
+		for _, ingress := range cluster.Ingresses {
+			domains += len(ingress.Frontends)
+		}
+	}
+	metrics.ViewLogicalClusters.Set(float64(len(s.LogicalClusters)))
+	metrics.ViewIngresses.Set(float64(ingresses))
+	metrics.ViewDomains.Set(float64(domains))
+}
+
+// listenerConfigs returns the configured listeners, or the default ones on all IPv4 addresses.
+func (s *LogicalView) listenerConfigs() []*ListenerConfig {
+	if len(s.ListenerConfigs) > 0 {
+		return s.ListenerConfigs
+	}
+	return []*ListenerConfig{
+		{Name: "http_listener", Protocol: ListenerHTTP, Port: s.HttpPort, statPrefix: "http"},
+		{Name: "https_listener", Protocol: ListenerTLS, Port: s.HttpsPort, statPrefix: "https"},
+	}
 }
 
 func (s *LogicalView) Listeners() []*listenerv3.Listener {
-	return []*listenerv3.Listener{
-		s.generateHttpListener(),
-		s.generateHttpsListener(),
+	result := []*listenerv3.Listener{}
+	for _, config := range s.listenerConfigs() {
+		switch config.Protocol {
+		case ListenerHTTP:
+			result = append(result, s.generateHttpListener(config))
+		case ListenerTLS:
+			result = append(result, s.generateHttpsListener(config))
+		}
 	}
+	return result
 }
 
 func (s *LogicalView) Clusters() []*clusterv3.Cluster {
@@ -77,32 +192,82 @@ func (s *LogicalView) Clusters() []*clusterv3.Cluster {
 	for _, cluster := range s.LogicalClusters {
 		result = append(result, cluster.Clusters()...)
 	}
+	if s.Fallback != nil {
+		result = append(result, s.Fallback.Clusters()...)
+	}
 	result = append(result, envoyBlackhole.GenerateCluster())
 	return result
 }
 
-func (s *LogicalView) generateHttpsListener() *listenerv3.Listener {
+// LoadAssignments returns the EDS endpoints of every EDS cluster returned by Clusters.
+func (s *LogicalView) LoadAssignments() []*endpointv3.ClusterLoadAssignment {
+	result := []*endpointv3.ClusterLoadAssignment{}
+	for _, cluster := range s.LogicalClusters {
+		result = append(result, cluster.LoadAssignments()...)
+	}
+	if s.Fallback != nil {
+		result = append(result, s.Fallback.LoadAssignments()...)
+	}
+	return result
+}
+
+// Routes returns the RDS route configurations referenced by Listeners, none
+// without an HTTP listener: the snapshot must not contain unreferenced routes.
+func (s *LogicalView) Routes() []*routev3.RouteConfiguration {
+	result := []*routev3.RouteConfiguration{}
+	for _, config := range s.listenerConfigs() {
+		if config.Protocol != ListenerHTTP {
+			continue
+		}
+		name := s.routeConfigName(config)
+		if slices.ContainsFunc(result, func(route *routev3.RouteConfiguration) bool {
+			return route.Name == name
+		}) {
+			continue
+		}
+		vhosts := []*routev3.VirtualHost{}
+		for _, cluster := range s.LogicalClusters {
+			vhosts = append(vhosts, cluster.VirtualHosts(config)...)
+		}
+		if s.Fallback != nil {
+			if vhost := s.Fallback.VirtualHost(); vhost != nil {
+				vhosts = append(vhosts, vhost)
+			}
+		}
+		result = append(result, &routev3.RouteConfiguration{
+			Name:         name,
+			VirtualHosts: vhosts,
+		})
+	}
+	return result
+}
+
+// routeConfigName returns the route configuration of an HTTP listener. Every
+// listener shares one unless an ingress picks listeners by PROXY protocol.
+func (s *LogicalView) routeConfigName(config *ListenerConfig) string {
+	for _, cluster := range s.LogicalClusters {
+		for _, ingress := range cluster.Ingresses {
+			if ingress.ListenerProxyProtocol != nil {
+				return httpRouteConfigName + "." + config.Name
+			}
+		}
+	}
+	return httpRouteConfigName
+}
+
+func (s *LogicalView) generateHttpsListener(config *ListenerConfig) *listenerv3.Listener {
 	filters := []*listenerv3.FilterChain{}
 	for _, cluster := range s.LogicalClusters {
-		filters = append(filters, cluster.TLSFilters()...)
-	}
-	filters = append(filters, envoyBlackhole.GenerateFilterChain())
-
-	return &listenerv3.Listener{
-		Name: "https_listener",
-		Address: &corev3.Address{
-			Address: &corev3.Address_SocketAddress{
-				SocketAddress: &corev3.SocketAddress{
-					Protocol: corev3.SocketAddress_TCP,
-					Address:  "0.0.0.0",
-					PortSpecifier: &corev3.SocketAddress_PortValue{
-						PortValue: s.HttpsPort,
-					},
-				},
-			},
-		},
-		StatPrefix: "https",
-		ListenerFilters: []*listenerv3.ListenerFilter{
+		filters = append(filters, cluster.TLSFilters(config)...)
+	}
+	if s.Fallback != nil {
+		filters = append(filters, s.Fallback.FilterChain())
+	} else {
+		filters = append(filters, envoyBlackhole.GenerateFilterChain())
+	}
+
+	return config.envoyListener(
+		[]*listenerv3.ListenerFilter{
 			{
 				Name: wellknown.TLSInspector,
 				ConfigType: &listenerv3.ListenerFilter_TypedConfig{
@@ -110,52 +275,33 @@ func (s *LogicalView) generateHttpsListener() *listenerv3.Listener {
 				},
 			},
 		},
-		FilterChains: filters,
-	}
+		filters,
+	)
 }
 
-func (s *LogicalView) generateHttpListener() *listenerv3.Listener {
-	vhosts := []*routev3.VirtualHost{}
-	for _, cluster := range s.LogicalClusters {
-		vhosts = append(vhosts, cluster.VirtualHosts()...)
-	}
-
-	return &listenerv3.Listener{
-		Name: "http_listener",
-		Address: &corev3.Address{
-			Address: &corev3.Address_SocketAddress{
-				SocketAddress: &corev3.SocketAddress{
-					Protocol: corev3.SocketAddress_TCP,
-					Address:  "0.0.0.0",
-					PortSpecifier: &corev3.SocketAddress_PortValue{
-						PortValue: s.HttpPort,
-					},
-				},
-			},
-		},
-		StatPrefix: "http",
-		FilterChains: []*listenerv3.FilterChain{{
-			Filters: []*listenerv3.Filter{{
-				Name: wellknown.HTTPConnectionManager,
-				ConfigType: &listenerv3.Filter_TypedConfig{
-					TypedConfig: utils.Must(anypb.New(
-						&http_connection_managerv3.HttpConnectionManager{
-							StatPrefix: "ingress_http",
-							RouteSpecifier: &http_connection_managerv3.HttpConnectionManager_RouteConfig{
-								RouteConfig: &routev3.RouteConfiguration{
-									Name:         "local_route",
-									VirtualHosts: vhosts,
-								},
+func (s *LogicalView) generateHttpListener(config *ListenerConfig) *listenerv3.Listener {
+	return config.envoyListener(nil, []*listenerv3.FilterChain{{
+		Filters: []*listenerv3.Filter{{
+			Name: wellknown.HTTPConnectionManager,
+			ConfigType: &listenerv3.Filter_TypedConfig{
+				TypedConfig: utils.Must(anypb.New(
+					&http_connection_managerv3.HttpConnectionManager{
+						StatPrefix: "ingress_http",
+						RouteSpecifier: &http_connection_managerv3.HttpConnectionManager_Rds{
+							Rds: &http_connection_managerv3.Rds{
+								ConfigSource:    adsConfigSource(),
+								RouteConfigName: s.routeConfigName(config),
 							},
-							HttpFilters: []*http_connection_managerv3.HttpFilter{{
-								Name: wellknown.Router,
-								ConfigType: &http_connection_managerv3.HttpFilter_TypedConfig{
-									TypedConfig: utils.Must(anypb.New(&routerv3.Router{})),
-								},
-							}},
-						})),
-				},
-			}},
+						},
+						HttpFilters: []*http_connection_managerv3.HttpFilter{{
+							Name: wellknown.Router,
+							ConfigType: &http_connection_managerv3.HttpFilter_TypedConfig{
+								TypedConfig: utils.Must(anypb.New(&routerv3.Router{})),
+							},
+						}},
+					})),
+			},
 		}},
-	}
+	}},
+	)
 }
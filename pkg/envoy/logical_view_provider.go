@@ -1,17 +1,74 @@
 package envoy
 
-import "context"
+import (
+	"context"
+	"sync"
+)
 
 type LogicalClusterProvider interface {
-	GetLogicaCluster(ctx context.Context) (*LogicalCluster, error)
+	// Name identifies the provider in logs, metrics and diags.
+	Name() string
+	GetLogicalClusters(ctx context.Context) ([]*LogicalCluster, error)
+}
+
+// LogicalClusterNotifier is implemented by providers that signal when their clusters change.
+// XDS rebuilds the view on every signal; providers without it are polled.
+type LogicalClusterNotifier interface {
+	Changes() <-chan struct{}
+}
+
+// LogicalClusterNamer is implemented by providers whose clusters can only have
+// the returned names, whatever they fetch. Providers without it may return any name.
+type LogicalClusterNamer interface {
+	LogicalClusterNames() []string
+}
+
+// ChangeNotifier is a helper for implementing LogicalClusterNotifier.
+// Notifications never block: changes made before the consumer caught up are coalesced.
+// The zero value is ready to use.
+type ChangeNotifier struct {
+	once sync.Once
+	ch   chan struct{}
+}
+
+func (n *ChangeNotifier) init() {
+	n.once.Do(func() {
+		n.ch = make(chan struct{}, 1)
+	})
+}
+
+func (n *ChangeNotifier) Notify() {
+	n.init()
+	select {
+	case n.ch <- struct{}{}:
+	default:
+	}
+}
+
+func (n *ChangeNotifier) Changes() <-chan struct{} {
+	n.init()
+	return n.ch
 }
 
 type StaticLogicalClusterProvider struct {
 	cluster *LogicalCluster
 }
 
-func (p *StaticLogicalClusterProvider) GetLogicaCluster(ctx context.Context) (*LogicalCluster, error) {
-	return p.cluster, nil
+func (p *StaticLogicalClusterProvider) Name() string {
+	return "static:" + p.cluster.Name
+}
+
+func (p *StaticLogicalClusterProvider) GetLogicalClusters(ctx context.Context) ([]*LogicalCluster, error) {
+	return []*LogicalCluster{p.cluster}, nil
+}
+
+func (p *StaticLogicalClusterProvider) LogicalClusterNames() []string {
+	return []string{p.cluster.Name}
+}
+
+// Changes returns a channel that never fires: a static cluster never changes and needs no polling.
+func (p *StaticLogicalClusterProvider) Changes() <-chan struct{} {
+	return nil
 }
 
 func NewStaticLogicalClusterProvider(cluster *LogicalCluster) *StaticLogicalClusterProvider {
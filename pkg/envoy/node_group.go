@@ -0,0 +1,244 @@
+package envoy
+
+import (
+	"fmt"
+	"path"
+	"slices"
+
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+)
+
+// Ports of the default listeners, unless a node group overrides them.
+const (
+	defaultHttpPort  = 80
+	defaultHttpsPort = 443
+)
+
+// DefaultNodeGroup receives the full view and serves every node that matches no configured group.
+const DefaultNodeGroup = "all"
+
+// ViewConfig configures how the logical view is served to Envoy nodes.
+type ViewConfig struct {
+	NodeGroups []*NodeGroup `json:"node_groups" yaml:"node_groups"`
+	// Listeners replace the default HTTP listener on port 80 and TLS listener
+	// on port 443 of every node group, unless the group sets its own.
+	Listeners []*ListenerConfig `json:"listeners,omitempty" yaml:"listeners,omitempty"`
+	// Fallback handles unknown hosts and SNI for every node group, unless it sets its own.
+	Fallback *FallbackConfig `json:"fallback,omitempty" yaml:"fallback,omitempty"`
+}
+
+// Normalize normalizes the addresses of the fallback upstreams.
+func (c *ViewConfig) Normalize() {
+	if c.Fallback != nil {
+		c.Fallback.Normalize()
+	}
+	for _, group := range c.NodeGroups {
+		if group != nil && group.Fallback != nil {
+			group.Fallback.Normalize()
+		}
+	}
+}
+
+func (c *ViewConfig) Validate() error {
+	errs := validationErrors{}
+	errs.addNested("", validateListeners(c.Listeners))
+	if c.Fallback != nil {
+		errs.addNested("fallback", c.Fallback.Validate())
+	}
+	uniqNames := map[string]struct{}{}
+	for i, group := range c.NodeGroups {
+		if group == nil {
+			errs.add("node_groups[%d] is nil", i)
+			continue
+		}
+		prefix := fmt.Sprintf("node_groups[%d]", i)
+		err := group.Validate()
+		errs.addNested(prefix, err)
+		if len(c.Listeners) > 0 && len(group.Listeners) == 0 && (group.HttpPort != 0 || group.HttpsPort != 0) {
+			errs.add("%s: http_port and https_port only apply to the default listeners, set listeners instead", prefix)
+		} else if err == nil && len(c.Listeners) == 0 && len(group.Listeners) == 0 {
+			// The group ports combine with the default ones, e.g. http_port 443 alone collides
+			errs.addNested(prefix, group.View(c.baseView()).validateListeners())
+		}
+		if _, ok := uniqNames[group.Name]; ok {
+			errs.add("node_groups[%d]: duplicate node group name: %s", i, group.Name)
+		}
+		uniqNames[group.Name] = struct{}{}
+	}
+	return errs.err()
+}
+
+// ValidateClusterNames checks that the logical_clusters of every node group can
+// be returned by the providers. Names are only known when every provider
+// implements LogicalClusterNamer, otherwise unknown names are reported as
+// warnings on every view update.
+func (c *ViewConfig) ValidateClusterNames(providers []LogicalClusterProvider) error {
+	known := map[string]struct{}{}
+	for _, provider := range providers {
+		namer, ok := provider.(LogicalClusterNamer)
+		if !ok {
+			return nil
+		}
+		for _, name := range namer.LogicalClusterNames() {
+			known[name] = struct{}{}
+		}
+	}
+	errs := validationErrors{}
+	for i, group := range c.NodeGroups {
+		for _, name := range group.LogicalClusters {
+			if _, ok := known[name]; !ok {
+				errs.add("node_groups[%d]: logical cluster %q is not provided by any provider", i, name)
+			}
+		}
+	}
+	return errs.err()
+}
+
+// baseView returns a view without clusters carrying the listeners every node group starts from.
+func (c *ViewConfig) baseView() *LogicalView {
+	return &LogicalView{
+		HttpPort:        defaultHttpPort,
+		HttpsPort:       defaultHttpsPort,
+		ListenerConfigs: c.Listeners,
+	}
+}
+
+// NodeGroup selects a set of Envoy nodes and the part of the view they receive.
+type NodeGroup struct {
+	Name  string    `json:"name" yaml:"name"`
+	Match NodeMatch `json:"match" yaml:"match"`
+
+	// LogicalClusters lists the names of the clusters served to the group, empty means all.
+	LogicalClusters []string `json:"logical_clusters" yaml:"logical_clusters"`
+	// HttpPort and HttpsPort override the listener ports of the view, 0 keeps the default.
+	HttpPort  uint32 `json:"http_port" yaml:"http_port"`
+	HttpsPort uint32 `json:"https_port" yaml:"https_port"`
+	// Listeners replace the listeners of the view for the group.
+	Listeners []*ListenerConfig `json:"listeners,omitempty" yaml:"listeners,omitempty"`
+	// Fallback replaces the fallback of the view for the group.
+	Fallback *FallbackConfig `json:"fallback,omitempty" yaml:"fallback,omitempty"`
+}
+
+func (g *NodeGroup) Validate() error {
+	errs := validationErrors{}
+	if g.Name == "" {
+		errs.add("name is required")
+	}
+	if g.Name == DefaultNodeGroup {
+		errs.add("name %q is reserved for nodes matching no group", DefaultNodeGroup)
+	}
+	errs.addNested("match", g.Match.Validate())
+	if g.HttpPort > 65535 {
+		errs.add("http_port must be less than or equal to 65535")
+	}
+	if g.HttpsPort > 65535 {
+		errs.add("https_port must be less than or equal to 65535")
+	}
+	if len(g.Listeners) > 0 && (g.HttpPort != 0 || g.HttpsPort != 0) {
+		errs.add("http_port and https_port cannot be combined with listeners")
+	}
+	errs.addNested("", validateListeners(g.Listeners))
+	if g.Fallback != nil {
+		errs.addNested("fallback", g.Fallback.Validate())
+	}
+	return errs.err()
+}
+
+// View returns the part of view served to the group.
+func (g *NodeGroup) View(view *LogicalView) *LogicalView {
+	result := &LogicalView{
+		HttpPort:  view.HttpPort,
+		HttpsPort: view.HttpsPort,
+
+		ListenerConfigs: view.ListenerConfigs,
+		Fallback:        view.Fallback,
+	}
+	if len(g.Listeners) > 0 {
+		result.ListenerConfigs = g.Listeners
+	}
+	if g.Fallback != nil {
+		result.Fallback = g.Fallback
+	}
+	if g.HttpPort != 0 {
+		result.HttpPort = g.HttpPort
+	}
+	if g.HttpsPort != 0 {
+		result.HttpsPort = g.HttpsPort
+	}
+	for _, cluster := range view.LogicalClusters {
+		if len(g.LogicalClusters) == 0 || slices.Contains(g.LogicalClusters, cluster.Name) {
+			result.LogicalClusters = append(result.LogicalClusters, cluster)
+		}
+	}
+	return result
+}
+
+// missingClusters returns the LogicalClusters names of the group absent from view.
+func (g *NodeGroup) missingClusters(view *LogicalView) []string {
+	result := []string{}
+	for _, name := range g.LogicalClusters {
+		if !slices.ContainsFunc(view.LogicalClusters, func(cluster *LogicalCluster) bool {
+			return cluster.Name == name
+		}) {
+			result = append(result, name)
+		}
+	}
+	return result
+}
+
+// NodeMatch selects nodes by their bootstrap identity. Every non-empty criterion
+// must match; within a list any entry may match. An empty match selects every node.
+type NodeMatch struct {
+	// Clusters matches node.cluster exactly.
+	Clusters []string `json:"clusters" yaml:"clusters"`
+	// IDs matches node.id against glob patterns, e.g. "edge-eu-*".
+	IDs []string `json:"ids" yaml:"ids"`
+	// Metadata matches string values of node.metadata.
+	Metadata map[string]string `json:"metadata" yaml:"metadata"`
+}
+
+func (m *NodeMatch) Validate() error {
+	errs := validationErrors{}
+	for i, pattern := range m.IDs {
+		if _, err := path.Match(pattern, ""); err != nil {
+			errs.add("ids[%d]: invalid glob %q: %w", i, pattern, err)
+		}
+	}
+	return errs.err()
+}
+
+func (m *NodeMatch) Matches(node *corev3.Node) bool {
+	if len(m.Clusters) > 0 && !slices.Contains(m.Clusters, node.GetCluster()) {
+		return false
+	}
+	if len(m.IDs) > 0 && !slices.ContainsFunc(m.IDs, func(pattern string) bool {
+		matched, _ := path.Match(pattern, node.GetId())
+		return matched
+	}) {
+		return false
+	}
+	for key, expected := range m.Metadata {
+		value, ok := node.GetMetadata().GetFields()[key]
+		if !ok || value.GetStringValue() != expected {
+			return false
+		}
+	}
+	return true
+}
+
+// NodeGroupHash maps a node to the first node group it matches, or DefaultNodeGroup.
+type NodeGroupHash struct {
+	groups []*NodeGroup
+}
+
+func (h NodeGroupHash) ID(node *corev3.Node) string {
+	if node == nil {
+		return DefaultNodeGroup
+	}
+	for _, group := range h.groups {
+		if group.Match.Matches(node) {
+			return group.Name
+		}
+	}
+	return DefaultNodeGroup
+}
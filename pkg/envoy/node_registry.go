@@ -0,0 +1,143 @@
+package envoy
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/v3"
+)
+
+// ConnectedNode describes an open xDS stream and the Envoy node behind it.
+type ConnectedNode struct {
+	StreamID    int64     `json:"stream_id"`
+	Delta       bool      `json:"delta"`
+	PeerAddress string    `json:"peer_address,omitempty"`
+	ConnectedAt time.Time `json:"connected_at"`
+
+	NodeID           string        `json:"node_id"`
+	NodeCluster      string        `json:"node_cluster"`
+	NodeGroup        string        `json:"node_group,omitempty"`
+	Locality         *NodeLocality `json:"locality,omitempty"`
+	UserAgent        string        `json:"user_agent,omitempty"`
+	UserAgentVersion string        `json:"user_agent_version,omitempty"`
+
+	SubscribedTypeURLs []string `json:"subscribed_type_urls"`
+	// AckedVersions maps every subscribed type URL to the last version the node ACKed
+	AckedVersions map[string]string `json:"acked_versions"`
+}
+
+type NodeLocality struct {
+	Region  string `json:"region,omitempty"`
+	Zone    string `json:"zone,omitempty"`
+	SubZone string `json:"sub_zone,omitempty"`
+}
+
+// NodeRegistry is the inventory of connected Envoy nodes, fed by XDSCallbacks.
+type NodeRegistry struct {
+	hash cache.NodeHash
+
+	mu    sync.RWMutex
+	nodes map[int64]*ConnectedNode
+}
+
+// NewNodeRegistry creates an empty registry; hash resolves the node group of every node.
+func NewNodeRegistry(hash cache.NodeHash) *NodeRegistry {
+	return &NodeRegistry{hash: hash, nodes: map[int64]*ConnectedNode{}}
+}
+
+func (r *NodeRegistry) open(streamID int64, delta bool, peerAddress string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.nodes[streamID] = &ConnectedNode{
+		StreamID:      streamID,
+		Delta:         delta,
+		PeerAddress:   peerAddress,
+		ConnectedAt:   time.Now(),
+		AckedVersions: map[string]string{},
+	}
+}
+
+// identify fills in the node of a stream. Envoy only has to send it in the first request.
+func (r *NodeRegistry) identify(streamID int64, node *corev3.Node) {
+	if node == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	connected, ok := r.nodes[streamID]
+	if !ok || connected.NodeID != "" {
+		return
+	}
+	connected.NodeID = node.GetId()
+	connected.NodeCluster = node.GetCluster()
+	connected.NodeGroup = r.hash.ID(node)
+	connected.UserAgent = node.GetUserAgentName()
+	connected.UserAgentVersion = userAgentVersion(node)
+	if locality := node.GetLocality(); locality != nil {
+		connected.Locality = &NodeLocality{
+			Region:  locality.GetRegion(),
+			Zone:    locality.GetZone(),
+			SubZone: locality.GetSubZone(),
+		}
+	}
+}
+
+func (r *NodeRegistry) subscribe(streamID int64, typeURL string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if connected, ok := r.nodes[streamID]; ok {
+		connected.SubscribedTypeURLs = append(connected.SubscribedTypeURLs, typeURL)
+		sort.Strings(connected.SubscribedTypeURLs)
+	}
+}
+
+func (r *NodeRegistry) ack(streamID int64, typeURL, version string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if connected, ok := r.nodes[streamID]; ok {
+		connected.AckedVersions[typeURL] = version
+	}
+}
+
+func (r *NodeRegistry) close(streamID int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.nodes, streamID)
+}
+
+// Nodes returns a copy of all connected nodes ordered by node id.
+func (r *NodeRegistry) Nodes() []ConnectedNode {
+	r.mu.RLock()
+	result := make([]ConnectedNode, 0, len(r.nodes))
+	for _, connected := range r.nodes {
+		node := *connected
+		node.SubscribedTypeURLs = append([]string{}, connected.SubscribedTypeURLs...)
+		node.AckedVersions = make(map[string]string, len(connected.AckedVersions))
+		for typeURL, version := range connected.AckedVersions {
+			node.AckedVersions[typeURL] = version
+		}
+		result = append(result, node)
+	}
+	r.mu.RUnlock()
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].NodeID != result[j].NodeID {
+			return result[i].NodeID < result[j].NodeID
+		}
+		return result[i].StreamID < result[j].StreamID
+	})
+	return result
+}
+
+func userAgentVersion(node *corev3.Node) string {
+	if version := node.GetUserAgentVersion(); version != "" {
+		return version
+	}
+	semver := node.GetUserAgentBuildVersion().GetVersion()
+	if semver == nil {
+		return ""
+	}
+	return fmt.Sprintf("%d.%d.%d", semver.GetMajorNumber(), semver.GetMinorNumber(), semver.GetPatch())
+}
@@ -0,0 +1,170 @@
+package envoy
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/paragor/faraway-edge/pkg/log"
+	"github.com/paragor/faraway-edge/pkg/metrics"
+)
+
+// ProviderStaleError is the status of a provider that fails while its last
+// valid clusters are still served. It marks the provider as degraded, not down.
+type ProviderStaleError struct {
+	Age time.Duration
+	Err error
+}
+
+func (e *ProviderStaleError) Error() string {
+	return fmt.Sprintf("serving clusters fetched %s ago: %v", e.Age.Round(time.Second), e.Err)
+}
+
+func (e *ProviderStaleError) Unwrap() error {
+	return e.Err
+}
+
+func (e *ProviderStaleError) Degraded() bool {
+	return true
+}
+
+// ProviderRestoredError is the status of a provider without usable clusters
+// while the view restored from the state file is served. It marks the provider
+// as degraded, not down.
+type ProviderRestoredError struct {
+	Err error
+}
+
+func (e *ProviderRestoredError) Error() string {
+	return fmt.Sprintf("serving the state file: %v", e.Err)
+}
+
+func (e *ProviderRestoredError) Unwrap() error {
+	return e.Err
+}
+
+func (e *ProviderRestoredError) Degraded() bool {
+	return true
+}
+
+// providerCache keeps the last valid clusters of every provider, so that one
+// failing provider does not block updates of the others. Cached clusters older
+// than maxStaleness are dropped from the view; zero means they never expire.
+type providerCache struct {
+	maxStaleness time.Duration
+	resolver     *conflictResolver
+
+	mu      sync.RWMutex
+	entries map[string]*providerCacheEntry
+}
+
+type providerCacheEntry struct {
+	clusters []*LogicalCluster
+	// conflicts are the domain conflicts resolved between the clusters
+	conflicts []DomainConflict
+	fetchedAt time.Time
+	// err is the error of the last fetch
+	err error
+}
+
+func newProviderCache(maxStaleness time.Duration, resolver *conflictResolver) *providerCache {
+	return &providerCache{maxStaleness: maxStaleness, resolver: resolver, entries: map[string]*providerCacheEntry{}}
+}
+
+func (c *providerCache) expired(entry *providerCacheEntry) bool {
+	return c.maxStaleness > 0 && time.Since(entry.fetchedAt) > c.maxStaleness
+}
+
+// fetch returns the clusters of provider with domain conflicts between them
+// resolved, falling back to its last valid clusters when it fails.
+// It fails only if the provider never returned valid clusters.
+func (c *providerCache) fetch(ctx context.Context, provider LogicalClusterProvider) ([]*LogicalCluster, []DomainConflict, error) {
+	name := provider.Name()
+	logger := log.FromContext(ctx).With(slog.String("provider", name))
+
+	clusters, err := provider.GetLogicalClusters(ctx)
+	var conflicts []DomainConflict
+	if err == nil {
+		clusters, conflicts = c.resolver.resolve([]providerClusters{{provider: name, clusters: clusters}})
+		if validationErr := ValidateLogicalClusters(clusters); validationErr != nil {
+			err = fmt.Errorf("invalid clusters: %w", validationErr)
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[name]
+	if !ok {
+		entry = &providerCacheEntry{}
+		c.entries[name] = entry
+	}
+
+	if err == nil {
+		entry.clusters = clusters
+		entry.conflicts = conflicts
+		entry.fetchedAt = time.Now()
+		entry.err = nil
+		metrics.ProviderStale.WithLabelValues(name).Set(0)
+		metrics.ProviderLastSuccess.WithLabelValues(name).SetToCurrentTime()
+		return clusters, conflicts, nil
+	}
+
+	entry.err = err
+	metrics.ProviderErrors.WithLabelValues(name).Inc()
+	if entry.clusters == nil {
+		return nil, nil, err
+	}
+	metrics.ProviderStale.WithLabelValues(name).Set(1)
+	age := time.Since(entry.fetchedAt)
+	if c.expired(entry) {
+		logger.Error("Provider clusters exceeded max staleness, dropping them from the view",
+			slog.Duration("age", age), slog.Duration("max_staleness", c.maxStaleness), log.Error(err))
+		return nil, nil, nil
+	}
+	logger.Warn("Provider failed, serving its last valid clusters", slog.Duration("age", age), log.Error(err))
+	return entry.clusters, entry.conflicts, nil
+}
+
+// degraded reports whether any provider is currently served from the cache or dropped.
+func (c *providerCache) degraded() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for _, entry := range c.entries {
+		if entry.err != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// lastError returns the error of the last fetch of the provider, such as
+// clusters rejected by validation, or nil.
+func (c *providerCache) lastError(name string) error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if entry, ok := c.entries[name]; ok {
+		return entry.err
+	}
+	return nil
+}
+
+// status is nil for a healthy provider, a *ProviderStaleError while its
+// cached clusters are served, and any other error when it has no usable clusters.
+func (c *providerCache) status(name string) error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	entry, ok := c.entries[name]
+	switch {
+	case !ok:
+		return fmt.Errorf("no clusters fetched yet")
+	case entry.err == nil:
+		return nil
+	case entry.clusters == nil:
+		return entry.err
+	case c.expired(entry):
+		return fmt.Errorf("clusters are older than max staleness %s and dropped from the view: %w", c.maxStaleness, entry.err)
+	}
+	return &ProviderStaleError{Age: time.Since(entry.fetchedAt), Err: entry.err}
+}
@@ -0,0 +1,125 @@
+package envoy
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/paragor/faraway-edge/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func newTestProviderCache(maxStaleness time.Duration, provider *fakeProvider) *providerCache {
+	resolver := newConflictResolver(ConflictConfig{Policy: ConflictRejectAll}, []LogicalClusterProvider{provider})
+	return newProviderCache(maxStaleness, resolver)
+}
+
+func TestProviderCacheFirstFetchFails(t *testing.T) {
+	failure := errors.New("api is down")
+	provider := &fakeProvider{name: "cache-first", err: failure}
+	cache := newTestProviderCache(time.Minute, provider)
+
+	if err := cache.status(provider.name); err == nil {
+		t.Errorf("expected a provider that was never fetched to fail")
+	}
+	clusters, _, err := cache.fetch(context.Background(), provider)
+	if !errors.Is(err, failure) || clusters != nil {
+		t.Fatalf("expected the fetch error and no clusters, got %v, %v", clusters, err)
+	}
+	var stale *ProviderStaleError
+	if err := cache.status(provider.name); !errors.Is(err, failure) || errors.As(err, &stale) {
+		t.Errorf("expected status to be the fetch error, not stale, got %v", err)
+	}
+
+	// Invalid clusters are a failure too
+	provider.err = nil
+	provider.clusters = []*LogicalCluster{testCluster("a", testIngress("app", time.Time{}, "Bad Domain"))}
+	if _, _, err := cache.fetch(context.Background(), provider); err == nil || !strings.Contains(err.Error(), "invalid clusters") {
+		t.Fatalf("expected invalid clusters to fail the fetch, got %v", err)
+	}
+}
+
+func TestProviderCacheStaleness(t *testing.T) {
+	const maxStaleness = 50 * time.Millisecond
+	provider := &fakeProvider{
+		name:     "cache-stale",
+		clusters: []*LogicalCluster{testCluster("a", testIngress("app", time.Time{}, "a.example.com"))},
+	}
+	cache := newTestProviderCache(maxStaleness, provider)
+	stale := metrics.ProviderStale.WithLabelValues(provider.name)
+
+	if _, _, err := cache.fetch(context.Background(), provider); err != nil {
+		t.Fatalf("fetch: %v", err)
+	}
+	if err := cache.status(provider.name); err != nil {
+		t.Errorf("expected a healthy provider, got %v", err)
+	}
+
+	failure := errors.New("api is down")
+	provider.clusters = nil
+	provider.err = failure
+	clusters, _, err := cache.fetch(context.Background(), provider)
+	if err != nil {
+		t.Fatalf("expected the cached clusters to be served, got %v", err)
+	}
+	if got := servedDomains(clusters); !slices.Equal(got, []string{"a/app/a.example.com"}) {
+		t.Errorf("expected the cached clusters, got %v", got)
+	}
+	var staleErr *ProviderStaleError
+	if err := cache.status(provider.name); !errors.As(err, &staleErr) || !errors.Is(err, failure) {
+		t.Errorf("expected a *ProviderStaleError wrapping the fetch error, got %v", err)
+	}
+	if value := testutil.ToFloat64(stale); value != 1 {
+		t.Errorf("expected stale metric 1, got %v", value)
+	}
+
+	time.Sleep(2 * maxStaleness)
+	clusters, _, err = cache.fetch(context.Background(), provider)
+	if err != nil || clusters != nil {
+		t.Fatalf("expected the expired clusters to be dropped, got %v, %v", clusters, err)
+	}
+	err = cache.status(provider.name)
+	if err == nil || errors.As(err, &staleErr) || !errors.Is(err, failure) {
+		t.Errorf("expected expired clusters to fail the provider, got %v", err)
+	}
+
+	// A successful fetch restores the provider
+	provider.clusters = []*LogicalCluster{testCluster("a", testIngress("app", time.Time{}, "b.example.com"))}
+	provider.err = nil
+	clusters, _, err = cache.fetch(context.Background(), provider)
+	if err != nil || !slices.Equal(servedDomains(clusters), []string{"a/app/b.example.com"}) {
+		t.Fatalf("expected the new clusters, got %v, %v", servedDomains(clusters), err)
+	}
+	if err := cache.status(provider.name); err != nil {
+		t.Errorf("expected a healthy provider, got %v", err)
+	}
+	if value := testutil.ToFloat64(stale); value != 0 {
+		t.Errorf("expected stale metric 0, got %v", value)
+	}
+}
+
+func TestProviderCacheNoStalenessLimit(t *testing.T) {
+	provider := &fakeProvider{
+		name:     "cache-forever",
+		clusters: []*LogicalCluster{testCluster("a", testIngress("app", time.Time{}, "a.example.com"))},
+	}
+	cache := newTestProviderCache(0, provider)
+	if _, _, err := cache.fetch(context.Background(), provider); err != nil {
+		t.Fatalf("fetch: %v", err)
+	}
+	cache.entries[provider.name].fetchedAt = time.Now().Add(-24 * time.Hour)
+
+	provider.clusters = nil
+	provider.err = errors.New("api is down")
+	clusters, _, err := cache.fetch(context.Background(), provider)
+	if err != nil || len(clusters) != 1 {
+		t.Fatalf("expected the cached clusters to be served forever, got %v, %v", clusters, err)
+	}
+	var staleErr *ProviderStaleError
+	if err := cache.status(provider.name); !errors.As(err, &staleErr) {
+		t.Errorf("expected a *ProviderStaleError, got %v", err)
+	}
+}
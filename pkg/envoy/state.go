@@ -0,0 +1,80 @@
+package envoy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// persistedState is the content of the state file: the last view applied from
+// live provider data, served on startup while the providers warm up.
+type persistedState struct {
+	Version string       `json:"version"`
+	SavedAt time.Time    `json:"saved_at"`
+	View    *LogicalView `json:"view"`
+}
+
+// saveState atomically replaces the state file, so a crash never leaves a truncated file behind.
+// Listeners and fallback are not persisted, they come from the view config on restore.
+func saveState(path string, version string, view *LogicalView) error {
+	persisted := *view
+	persisted.ListenerConfigs = nil
+	persisted.Fallback = nil
+	data, err := json.Marshal(persistedState{Version: version, SavedAt: time.Now(), View: &persisted})
+	if err != nil {
+		return fmt.Errorf("failed to encode state: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary state file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to sync state file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close state file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace state file: %w", err)
+	}
+	return nil
+}
+
+// loadState reads the state file and validates its view with the current
+// listeners and fallback, which may have changed since the state was saved.
+func loadState(path string, listeners []*ListenerConfig, fallback *FallbackConfig) (*persistedState, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	state := &persistedState{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(state); err != nil {
+		return nil, fmt.Errorf("failed to decode state file %s: %w", path, err)
+	}
+	if state.View == nil {
+		return nil, fmt.Errorf("state file %s has no view", path)
+	}
+	state.View.ListenerConfigs = listeners
+	state.View.Fallback = fallback
+	for _, cluster := range state.View.LogicalClusters {
+		if cluster != nil {
+			cluster.Source = "state:" + path
+		}
+	}
+	if err := state.View.Validate(); err != nil {
+		return nil, fmt.Errorf("state file %s is invalid: %w", path, err)
+	}
+	return state, nil
+}
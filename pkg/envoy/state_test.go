@@ -0,0 +1,120 @@
+package envoy
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStateRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	saved := &LogicalView{
+		LogicalClusters: []*LogicalCluster{testCluster("static", testIngress("app", time.Time{}, "a.example.com", "*.example.com"))},
+		HttpPort:        defaultHttpPort,
+		HttpsPort:       defaultHttpsPort,
+		ListenerConfigs: []*ListenerConfig{{Name: "old", Protocol: ListenerHTTP, Port: 8080}},
+		Fallback:        &FallbackConfig{DirectResponse: &DirectResponse{Status: 404}},
+	}
+	if err := saveState(path, "v1", saved); err != nil {
+		t.Fatalf("saveState: %v", err)
+	}
+	if len(saved.ListenerConfigs) != 1 || saved.Fallback == nil {
+		t.Fatalf("saveState must not modify the view")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading state file: %v", err)
+	}
+	if strings.Contains(string(data), `"listeners"`) || strings.Contains(string(data), `"fallback"`) {
+		t.Errorf("listeners and fallback must not be persisted: %s", data)
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(path)); len(entries) != 1 {
+		t.Errorf("expected only the state file to be left, got %d files", len(entries))
+	}
+
+	listeners := []*ListenerConfig{{Name: "new", Protocol: ListenerTLS, Port: 8443}}
+	fallback := &FallbackConfig{DirectResponse: &DirectResponse{Status: 503}}
+	state, err := loadState(path, listeners, fallback)
+	if err != nil {
+		t.Fatalf("loadState: %v", err)
+	}
+	if state.Version != "v1" || time.Since(state.SavedAt) > time.Minute {
+		t.Errorf("unexpected version %q saved at %s", state.Version, state.SavedAt)
+	}
+	if got := servedDomains(state.View.LogicalClusters); !slices.Equal(got, []string{"static/app/a.example.com", "static/app/*.example.com"}) {
+		t.Errorf("unexpected restored domains %v", got)
+	}
+	if source := state.View.LogicalClusters[0].Source; source != "state:"+path {
+		t.Errorf("expected the clusters to point at the state file, got source %q", source)
+	}
+	if !slices.Equal(state.View.ListenerConfigs, listeners) || state.View.Fallback != fallback {
+		t.Errorf("expected the current listeners and fallback, got %+v and %+v", state.View.ListenerConfigs, state.View.Fallback)
+	}
+}
+
+func TestLoadStateValidatesWithCurrentConfig(t *testing.T) {
+	view := `{"logical_clusters": [{"name": "static", "ingresses": [{"name": "app",
+		"http_upstream": {"port": 80, "static_addresses": ["10.0.0.1"], "connect_timeout": "1s"},
+		"https_upstream": {"port": 443, "static_addresses": ["10.0.0.1"], "connect_timeout": "1s"},
+		"frontends": [{"domain": "a.example.com"}]}]}],
+		"http_port": 80, "https_port": 443`
+	tests := []struct {
+		name      string
+		data      string
+		listeners []*ListenerConfig
+		wantErr   string
+	}{
+		{
+			name: "invalid persisted listeners are replaced before validation",
+			data: `{"version": "v1", "view": ` + view + `,
+				"listeners": [{"name": "a", "protocol": "http", "port": 80}, {"name": "a", "protocol": "http", "port": 80}],
+				"fallback": {}}}`,
+		},
+		{
+			name:      "current listeners are validated",
+			data:      `{"version": "v1", "view": ` + view + `}}`,
+			listeners: []*ListenerConfig{{Name: "a", Protocol: ListenerHTTP, Port: 80}, {Name: "b", Protocol: ListenerTLS, Port: 80}},
+			wantErr:   `0.0.0.0:80 is already bound by listener "a"`,
+		},
+		{
+			name:    "no view",
+			data:    `{"version": "v1"}`,
+			wantErr: "has no view",
+		},
+		{
+			name:    "no clusters",
+			data:    `{"version": "v1", "view": {"http_port": 80, "https_port": 443}}`,
+			wantErr: "logical_clusters is required",
+		},
+		{
+			name:    "unknown field",
+			data:    `{"version": "v1", "vew": {}}`,
+			wantErr: `unknown field "vew"`,
+		},
+		{
+			name:    "truncated",
+			data:    `{"version": "v1", "view": {`,
+			wantErr: "failed to decode state file",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "state.json")
+			if err := os.WriteFile(path, []byte(test.data), 0o600); err != nil {
+				t.Fatalf("writing state file: %v", err)
+			}
+			_, err := loadState(path, test.listeners, nil)
+			checkError(t, "loadState", err, test.wantErr)
+		})
+	}
+}
+
+func TestLoadStateMissingFile(t *testing.T) {
+	_, err := loadState(filepath.Join(t.TempDir(), "missing.json"), nil, nil)
+	if !os.IsNotExist(err) {
+		t.Errorf("expected a not exist error, got %v", err)
+	}
+}
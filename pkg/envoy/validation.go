@@ -0,0 +1,36 @@
+package envoy
+
+import (
+	"errors"
+	"fmt"
+)
+
+// validationErrors collects every problem found during validation,
+// so that a broken config can be fixed in one pass.
+type validationErrors []error
+
+func (e *validationErrors) add(format string, args ...any) {
+	*e = append(*e, fmt.Errorf(format, args...))
+}
+
+// addNested records each problem reported by err under prefix, if any.
+func (e *validationErrors) addNested(prefix string, err error) {
+	if err == nil {
+		return
+	}
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		for _, inner := range joined.Unwrap() {
+			e.addNested(prefix, inner)
+		}
+		return
+	}
+	if prefix == "" {
+		*e = append(*e, err)
+		return
+	}
+	*e = append(*e, fmt.Errorf("%s: %w", prefix, err))
+}
+
+func (e validationErrors) err() error {
+	return errors.Join(e...)
+}
@@ -4,59 +4,191 @@ import (
 	"context"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"net"
+	"os"
 	"sort"
+	"sync"
+	"sync/atomic"
 	"time"
 
-	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	clusterservicev3 "github.com/envoyproxy/go-control-plane/envoy/service/cluster/v3"
 	discoveryv3 "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+	endpointservicev3 "github.com/envoyproxy/go-control-plane/envoy/service/endpoint/v3"
+	listenerservicev3 "github.com/envoyproxy/go-control-plane/envoy/service/listener/v3"
+	routeservicev3 "github.com/envoyproxy/go-control-plane/envoy/service/route/v3"
 	"github.com/envoyproxy/go-control-plane/pkg/cache/types"
 	"github.com/envoyproxy/go-control-plane/pkg/cache/v3"
 	"github.com/envoyproxy/go-control-plane/pkg/resource/v3"
 	"github.com/envoyproxy/go-control-plane/pkg/server/sotw/v3"
 	"github.com/envoyproxy/go-control-plane/pkg/server/v3"
 	"github.com/paragor/faraway-edge/pkg/log"
+	"github.com/paragor/faraway-edge/pkg/metrics"
 	"github.com/paragor/faraway-edge/pkg/utils"
+	"github.com/prometheus/client_golang/prometheus"
 	"google.golang.org/grpc"
 	"google.golang.org/protobuf/proto"
 )
 
+const (
+	viewPollInterval = 15 * time.Second
+	viewDebounce     = 500 * time.Millisecond
+	viewDebounceMax  = 5 * time.Second
+	// updateLoopStallTimeout is how long the update loop may go without
+	// progress before the liveness check fails
+	updateLoopStallTimeout = 4 * viewPollInterval
+)
+
 type XDS struct {
 	cacheManager cache.SnapshotCache
 	providers    []LogicalClusterProvider
+	providerData *providerCache
+	resolver     *conflictResolver
 	server       server.Server
-	port         int
-	lastHash     string
+	listen       string
+	stateFile    string
+	nodeGroups   []*NodeGroup
+	listeners    []*ListenerConfig
+	fallback     *FallbackConfig
 	token        string
+	configStatus *ConfigStatusTracker
+	nodes        *NodeRegistry
+	history      snapshotHistory
+	// refresh asks the update loop to rebuild the view
+	refresh ChangeNotifier
+
+	// updateMu serializes snapshot updates and guards the fields below
+	updateMu sync.Mutex
+	lastHash map[string]string
+	// pinned is the history version updates are frozen at
+	pinned string
+
+	// heartbeat is the unix nano time the update loop last made progress
+	heartbeat   atomic.Int64
+	snapshotSet atomic.Bool
+	serving     atomic.Bool
+	// restored is set while the view of the state file is served, until the providers replace it
+	restored atomic.Bool
 }
 
-func NewXDS(xdsPort int, providers []LogicalClusterProvider, token string) *XDS {
-	return &XDS{
-		cacheManager: cache.NewSnapshotCache(true, AllCache{}, nil),
-		port:         xdsPort,
+// NewXDS creates an xDS server listening on listen, see utils.Listen for the address format.
+// viewConfig is optional; without node groups every node receives the full view.
+// stateFile is optional; when set the last view applied from the providers is
+// persisted there and served on the next startup until the providers are ready.
+// A failing provider keeps contributing its last valid clusters for up to
+// providerMaxStaleness, zero meaning forever. Domains claimed by several
+// ingresses are resolved according to conflicts.
+func NewXDS(listen string, providers []LogicalClusterProvider, token string, viewConfig *ViewConfig, stateFile string, providerMaxStaleness time.Duration, conflicts ConflictConfig) *XDS {
+	if viewConfig == nil {
+		viewConfig = &ViewConfig{}
+	}
+	nodeHash := NodeGroupHash{groups: viewConfig.NodeGroups}
+	resolver := newConflictResolver(conflicts, providers)
+	xds := &XDS{
+		cacheManager: cache.NewSnapshotCache(true, nodeHash, nil),
+		listen:       listen,
+		stateFile:    stateFile,
 		providers:    providers,
+		providerData: newProviderCache(providerMaxStaleness, resolver),
+		resolver:     resolver,
+		nodeGroups:   viewConfig.NodeGroups,
+		listeners:    viewConfig.Listeners,
+		fallback:     viewConfig.Fallback,
+		lastHash:     map[string]string{},
 		token:        token,
+		configStatus: NewConfigStatusTracker(),
+		nodes:        NewNodeRegistry(nodeHash),
+	}
+	xds.beat()
+	return xds
+}
+
+func (xds *XDS) beat() {
+	xds.heartbeat.Store(time.Now().UnixNano())
+}
+
+// CheckUpdateLoop is a liveness check failing when the loop building snapshots is stuck.
+func (xds *XDS) CheckUpdateLoop() error {
+	since := time.Since(time.Unix(0, xds.heartbeat.Load()))
+	if since > updateLoopStallTimeout {
+		return fmt.Errorf("update loop made no progress for %s", since.Round(time.Second))
 	}
+	return nil
+}
+
+// CheckSnapshot is a readiness check failing until the first snapshot is set.
+func (xds *XDS) CheckSnapshot() error {
+	if !xds.snapshotSet.Load() {
+		return fmt.Errorf("initial snapshot is not set yet")
+	}
+	return nil
+}
+
+// ProviderCheck returns a readiness check for a provider. It fails while the
+// provider has no usable clusters and reports a *ProviderStaleError while its
+// last valid clusters are served in place of failing fetches. While the state
+// file is served a provider without usable clusters is only degraded, the
+// restored view is complete and Envoy must be able to fetch it.
+func (xds *XDS) ProviderCheck(provider LogicalClusterProvider) func() error {
+	return func() error {
+		err := xds.providerData.status(provider.Name())
+		var stale *ProviderStaleError
+		if err != nil && xds.restored.Load() && !errors.As(err, &stale) {
+			return &ProviderRestoredError{Err: err}
+		}
+		return err
+	}
+}
+
+// ProviderStatus returns the error of the last fetch of a provider, for
+// clusters the provider loaded fine but the view rejected, e.g. a domain
+// conflict between files under the reject policy.
+func (xds *XDS) ProviderStatus(provider LogicalClusterProvider) func() error {
+	return func() error {
+		return xds.providerData.lastError(provider.Name())
+	}
+}
+
+// CheckListener is a readiness check failing while the gRPC listener is not accepting connections.
+func (xds *XDS) CheckListener() error {
+	if !xds.serving.Load() {
+		return fmt.Errorf("xDS listener %s is not accepting connections", xds.listen)
+	}
+	return nil
 }
 
 func (xds *XDS) takeView(ctx context.Context) (*LogicalView, error) {
 	view := &LogicalView{
-		HttpPort:  80,
-		HttpsPort: 443,
+		HttpPort:         defaultHttpPort,
+		HttpsPort:        defaultHttpsPort,
+		ListenerConfigs:  xds.listeners,
+		Fallback:         xds.fallback,
+		providerVersions: map[string]string{},
 	}
+	sets := make([]providerClusters, 0, len(xds.providers))
+	conflicts := []DomainConflict{}
 	for _, provider := range xds.providers {
-		cluster, err := provider.GetLogicaCluster(ctx)
+		clusters, providerConflicts, err := xds.providerData.fetch(ctx, provider)
 		if err != nil {
-			return nil, err
+			return nil, fmt.Errorf("provider %s: %w", provider.Name(), err)
 		}
-		view.LogicalClusters = append(view.LogicalClusters, cluster)
+		sets = append(sets, providerClusters{provider: provider.Name(), clusters: clusters})
+		conflicts = append(conflicts, providerConflicts...)
+		view.providerVersions[provider.Name()] = providerVersion(clusters)
 	}
+	// Conflicts within a provider are resolved by the cache, these are the ones between providers
+	clusters, viewConflicts := xds.resolver.resolve(sets)
+	view.LogicalClusters = clusters
+	conflicts = append(conflicts, viewConflicts...)
 	if err := view.Validate(); err != nil {
+		xds.resolver.record(ctx, conflicts)
+		metrics.ViewValidationFailures.Inc()
 		return nil, fmt.Errorf("logical view validation failed: %w", err)
 	}
+	xds.resolver.record(ctx, append(conflicts, view.DomainOverlaps()...))
 	return view, nil
 }
 
@@ -68,6 +200,7 @@ func (xds *XDS) initProviders(ctx context.Context) error {
 			return ctx.Err()
 		default:
 		}
+		xds.beat()
 
 		view, err := xds.takeView(ctx)
 		if err != nil {
@@ -75,15 +208,74 @@ func (xds *XDS) initProviders(ctx context.Context) error {
 			time.Sleep(1 * time.Second)
 			continue
 		}
-		if err := xds.updateView(ctx, view); err != nil {
+		if _, err := xds.applyView(ctx, view); err != nil {
 			return err
 		}
 		return nil
 	}
 }
 
-func (xds *XDS) DumpCurrentSnapshot(writer io.Writer) error {
-	snap, err := xds.cacheManager.GetSnapshot("all")
+// History returns the applied views, newest first, and the pinned version if any.
+func (xds *XDS) History() any {
+	xds.updateMu.Lock()
+	pinned := xds.pinned
+	xds.updateMu.Unlock()
+	return History{Pinned: pinned, Entries: xds.history.list()}
+}
+
+// Pin serves the view of a historical version and freezes updates until Unpin.
+func (xds *XDS) Pin(ctx context.Context, version string) error {
+	entry, ok := xds.history.get(version)
+	if !ok {
+		return fmt.Errorf("version %q is not in the history", version)
+	}
+
+	xds.updateMu.Lock()
+	defer xds.updateMu.Unlock()
+	if _, err := xds.updateView(ctx, entry.view); err != nil {
+		return fmt.Errorf("failed to apply version %s: %w", version, err)
+	}
+	xds.pinned = version
+	metrics.SnapshotPinned.Set(1)
+	log.FromContext(ctx).Warn("Snapshot pinned, updates are frozen", slog.String("version", version))
+	return nil
+}
+
+// Unpin resumes updates and rebuilds the view from the providers.
+func (xds *XDS) Unpin(ctx context.Context) error {
+	xds.updateMu.Lock()
+	defer xds.updateMu.Unlock()
+	if xds.pinned == "" {
+		return nil
+	}
+	log.FromContext(ctx).Info("Snapshot unpinned, updates resumed", slog.String("version", xds.pinned))
+	xds.pinned = ""
+	metrics.SnapshotPinned.Set(0)
+	xds.refresh.Notify()
+	return nil
+}
+
+// ConfigStatus returns the last ACKed and NACKed version of every connected node and type URL.
+func (xds *XDS) ConfigStatus() any {
+	return xds.configStatus.Statuses()
+}
+
+// ConnectedNodes returns every open xDS stream with the node behind it.
+func (xds *XDS) ConnectedNodes() any {
+	return xds.nodes.Nodes()
+}
+
+// Conflicts returns the domain conflicts resolved in the last view.
+func (xds *XDS) Conflicts() any {
+	return xds.resolver.Conflicts()
+}
+
+// DumpCurrentSnapshot writes the snapshot of a node group, DefaultNodeGroup if group is empty.
+func (xds *XDS) DumpCurrentSnapshot(writer io.Writer, group string) error {
+	if group == "" {
+		group = DefaultNodeGroup
+	}
+	snap, err := xds.cacheManager.GetSnapshot(group)
 	if err != nil {
 		return err
 	}
@@ -91,36 +283,28 @@ func (xds *XDS) DumpCurrentSnapshot(writer io.Writer) error {
 	return utils.DumpSnapshotAsJson(snap, writer)
 }
 
-func (xds *XDS) RunServer(ctx context.Context, providerStartupTimeout time.Duration, onReady func()) error {
+// RunServer sets the initial snapshot, waiting up to providerStartupTimeout for
+// the providers, then serves xDS until ctx is done. When a state file could be
+// restored it is served right away and the providers are waited for in the background.
+func (xds *XDS) RunServer(ctx context.Context, providerStartupTimeout time.Duration) error {
 	logger := log.FromContext(ctx)
-	startupCtx, cancel := context.WithTimeout(ctx, providerStartupTimeout)
-	defer cancel()
-	if err := xds.initProviders(startupCtx); err != nil {
-		return fmt.Errorf("error initializing providers: %v", err)
-	}
-
-	go func() {
-		for {
-			select {
-			case <-ctx.Done():
+	if xds.restoreState(ctx) {
+		go func() {
+			if err := xds.initProviders(ctx); err != nil {
 				return
-			default:
 			}
-			time.Sleep(15 * time.Second)
-
-			view, err := xds.takeView(ctx)
-			if err != nil {
-				logger.Error("Error taking view", log.Error(err))
-				continue
-			}
-			if err := xds.updateView(ctx, view); err != nil {
-				logger.Error("Error updating view", log.Error(err))
-			}
-			onReady()
+			xds.runUpdateLoop(ctx)
+		}()
+	} else {
+		startupCtx, cancel := context.WithTimeout(ctx, providerStartupTimeout)
+		defer cancel()
+		if err := xds.initProviders(startupCtx); err != nil {
+			return fmt.Errorf("error initializing providers: %v", err)
 		}
-	}()
+		go xds.runUpdateLoop(ctx)
+	}
 
-	cb := NewXDSCallbacks(log.PutIntoContext(ctx, logger.With(slog.String("component", "envoy-xds"))))
+	cb := NewXDSCallbacks(log.PutIntoContext(ctx, logger.With(slog.String("component", "envoy-xds"))), xds.configStatus, xds.nodes)
 	xds.server = server.NewServer(ctx, xds.cacheManager, cb, sotw.WithOrderedADS())
 
 	// Create gRPC server with auth interceptors
@@ -129,19 +313,170 @@ func (xds *XDS) RunServer(ctx context.Context, providerStartupTimeout time.Durat
 		grpc.StreamInterceptor(TokenAuthStreamInterceptor(xds.token, logger)),
 	}
 	grpcServer := grpc.NewServer(grpcOpts...)
+	// ADS and the per-type services serve both state-of-the-world and delta (incremental) xDS
 	discoveryv3.RegisterAggregatedDiscoveryServiceServer(grpcServer, xds.server)
-	lis, err := net.Listen("tcp", ":18000")
+	clusterservicev3.RegisterClusterDiscoveryServiceServer(grpcServer, xds.server)
+	listenerservicev3.RegisterListenerDiscoveryServiceServer(grpcServer, xds.server)
+	routeservicev3.RegisterRouteDiscoveryServiceServer(grpcServer, xds.server)
+	endpointservicev3.RegisterEndpointDiscoveryServiceServer(grpcServer, xds.server)
+	lis, err := utils.Listen(xds.listen)
 	if err != nil {
 		return fmt.Errorf("failed to listen: %w", err)
 	}
-	if err := grpcServer.Serve(lis); err != nil {
+	logger.Info("xDS server started", slog.String("listen", xds.listen))
+	err = grpcServer.Serve(&servingListener{Listener: lis, serving: &xds.serving})
+	xds.serving.Store(false)
+	if err != nil {
 		return fmt.Errorf("serve failed: %w", err)
 	}
 	return nil
 }
 
-func (xds *XDS) calculateResourcesHash(resources map[resource.Type][]types.Resource) (string, error) {
+// servingListener marks the server as serving while it is accepting
+// connections, so the listener check turns healthy only once Serve is running
+// and fails as soon as accepting fails, before Serve returns.
+type servingListener struct {
+	net.Listener
+	serving *atomic.Bool
+}
+
+func (l *servingListener) Accept() (net.Conn, error) {
+	l.serving.Store(true)
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		l.serving.Store(false)
+	}
+	return conn, err
+}
+
+// restoreState serves the view persisted in the state file and reports whether it succeeded.
+func (xds *XDS) restoreState(ctx context.Context) bool {
+	if xds.stateFile == "" {
+		return false
+	}
+	logger := log.FromContext(ctx).With(slog.String("state_file", xds.stateFile))
+	state, err := loadState(xds.stateFile, xds.listeners, xds.fallback)
+	if err != nil {
+		if os.IsNotExist(err) {
+			logger.Info("No state file to restore, waiting for providers")
+		} else {
+			logger.Error("Cant restore state file, waiting for providers", log.Error(err))
+		}
+		return false
+	}
+
+	xds.updateMu.Lock()
+	defer xds.updateMu.Unlock()
+	if _, err := xds.updateView(ctx, state.View); err != nil {
+		logger.Error("Cant serve state file, waiting for providers", log.Error(err))
+		return false
+	}
+	// The first view from the providers must always be applied and persisted, even if it is the same
+	xds.lastHash = map[string]string{}
+	xds.restored.Store(true)
+	logger.Info("Serving state file until providers are ready",
+		slog.String("version", state.Version),
+		slog.Time("saved_at", state.SavedAt))
+	return true
+}
+
+// runUpdateLoop rebuilds the view whenever a provider reports a change,
+// and polls on viewPollInterval when some providers cannot report changes or are failing.
+// It beats the heartbeat checked by CheckUpdateLoop at least every viewPollInterval.
+func (xds *XDS) runUpdateLoop(ctx context.Context) {
+	logger := log.FromContext(ctx)
+
+	changed := make(chan struct{}, 1)
+	poll := false
+	for _, provider := range xds.providers {
+		notifier, ok := provider.(LogicalClusterNotifier)
+		if !ok {
+			poll = true
+			continue
+		}
+		go forwardChanges(ctx, notifier.Changes(), changed)
+	}
+	go forwardChanges(ctx, xds.refresh.Changes(), changed)
+
+	ticker := time.NewTicker(viewPollInterval)
+	defer ticker.Stop()
+
+	for {
+		xds.beat()
+		var changedAt time.Time
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			// Failing providers are retried and their cached clusters checked for staleness
+			if !poll && !xds.providerData.degraded() {
+				continue
+			}
+		case <-changed:
+			changedAt = time.Now()
+			if !debounce(ctx, changed) {
+				return
+			}
+		}
+
+		view, err := xds.takeView(ctx)
+		if err != nil {
+			logger.Error("Error taking view", log.Error(err))
+			continue
+		}
+		updated, err := xds.applyView(ctx, view)
+		if err != nil {
+			logger.Error("Error updating view", log.Error(err))
+			continue
+		}
+		if updated && !changedAt.IsZero() {
+			metrics.ChangeToSnapshotSeconds.Observe(time.Since(changedAt).Seconds())
+		}
+	}
+}
+
+func forwardChanges(ctx context.Context, from <-chan struct{}, to chan<- struct{}) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-from:
+			select {
+			case to <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+// debounce waits until changed has been quiet for viewDebounce, so that a burst
+// of changes results in a single rebuild. It never waits longer than viewDebounceMax.
+// It returns false if ctx is done.
+func debounce(ctx context.Context, changed <-chan struct{}) bool {
+	quiet := time.NewTimer(viewDebounce)
+	defer quiet.Stop()
+	deadline := time.NewTimer(viewDebounceMax)
+	defer deadline.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-changed:
+			quiet.Reset(viewDebounce)
+		case <-quiet.C:
+			return true
+		case <-deadline.C:
+			return true
+		}
+	}
+}
+
+// calculateResourcesHash returns the hash of all resources, used as the snapshot version,
+// and the hash of every single resource by type URL and name, used as per-resource
+// versions by delta xDS. Both only change when the resource content changes.
+func (xds *XDS) calculateResourcesHash(resources map[resource.Type][]types.Resource) (string, map[string]map[string]string, error) {
 	hasher := sha256.New()
+	versionMap := map[string]map[string]string{}
 
 	// Sort resource types for deterministic ordering
 	var resourceTypes []resource.Type
@@ -155,6 +490,7 @@ func (xds *XDS) calculateResourcesHash(resources map[resource.Type][]types.Resou
 	// Hash each resource deterministically
 	for _, resType := range resourceTypes {
 		resList := resources[resType]
+		versionMap[resType] = make(map[string]string, len(resList))
 
 		// Marshal each resource and collect with its hash for sorting
 		type resourceWithHash struct {
@@ -167,15 +503,17 @@ func (xds *XDS) calculateResourcesHash(resources map[resource.Type][]types.Resou
 			// Marshal each resource deterministically
 			data, err := proto.MarshalOptions{Deterministic: true}.Marshal(res)
 			if err != nil {
-				return "", fmt.Errorf("failed to marshal resource: %w", err)
+				return "", nil, fmt.Errorf("failed to marshal resource: %w", err)
 			}
-			// Calculate individual resource hash for sorting
+			// Calculate individual resource hash for sorting and delta versions
 			resHasher := sha256.New()
 			resHasher.Write(data)
+			resHash := hex.EncodeToString(resHasher.Sum(nil))
 			marshaledResources = append(marshaledResources, resourceWithHash{
-				hash: hex.EncodeToString(resHasher.Sum(nil)),
+				hash: resHash,
 				data: data,
 			})
+			versionMap[resType][cache.GetResourceName(res)] = resHash
 		}
 
 		// Sort by hash for deterministic ordering
@@ -189,27 +527,97 @@ func (xds *XDS) calculateResourcesHash(resources map[resource.Type][]types.Resou
 		}
 	}
 
-	return hex.EncodeToString(hasher.Sum(nil)), nil
+	return hex.EncodeToString(hasher.Sum(nil)), versionMap, nil
 }
 
-func (xds *XDS) updateView(ctx context.Context, view *LogicalView) error {
-	logger := log.FromContext(ctx)
+// applyView sets the snapshots of a view taken from the providers, unless
+// updates are pinned, and records it in the history.
+func (xds *XDS) applyView(ctx context.Context, view *LogicalView) (bool, error) {
+	xds.updateMu.Lock()
+	defer xds.updateMu.Unlock()
+	if xds.pinned != "" {
+		log.FromContext(ctx).Info("Snapshot pinned, skipping update", slog.String("pinned_version", xds.pinned))
+		return false, nil
+	}
+
+	updated, err := xds.updateView(ctx, view)
+	if err != nil {
+		return false, err
+	}
+	xds.restored.Store(false)
+	if !updated {
+		return false, nil
+	}
+	version := xds.lastHash[DefaultNodeGroup]
+	xds.history.add(&HistoryEntry{
+		Version:          version,
+		AppliedAt:        time.Now(),
+		ProviderVersions: view.providerVersions,
+		view:             view,
+	})
+	if xds.stateFile != "" {
+		if err := saveState(xds.stateFile, version, view); err != nil {
+			log.FromContext(ctx).Error("Cant persist state file", slog.String("state_file", xds.stateFile), log.Error(err))
+		}
+	}
+	return true, nil
+}
+
+// updateView sets the snapshot of every node group and reports whether any of them changed.
+// The caller must hold updateMu.
+func (xds *XDS) updateView(ctx context.Context, view *LogicalView) (bool, error) {
+	// Group views are checked before any group is updated, so nodes never get a half applied view
+	groupViews := make([]*LogicalView, 0, len(xds.nodeGroups))
+	for _, group := range xds.nodeGroups {
+		groupView := group.View(view)
+		if err := groupView.validateListeners(); err != nil {
+			return false, fmt.Errorf("node group %s: %w", group.Name, err)
+		}
+		if missing := group.missingClusters(view); len(missing) > 0 {
+			log.FromContext(ctx).Warn("Node group selects logical clusters missing from the view",
+				slog.String("node_group", group.Name),
+				slog.Any("logical_clusters", missing),
+			)
+		}
+		groupViews = append(groupViews, groupView)
+	}
+	updated, err := xds.updateNodeGroup(ctx, DefaultNodeGroup, view)
+	if err != nil {
+		return false, fmt.Errorf("node group %s: %w", DefaultNodeGroup, err)
+	}
+	for i, group := range xds.nodeGroups {
+		groupUpdated, err := xds.updateNodeGroup(ctx, group.Name, groupViews[i])
+		if err != nil {
+			return false, fmt.Errorf("node group %s: %w", group.Name, err)
+		}
+		updated = updated || groupUpdated
+	}
+	xds.snapshotSet.Store(true)
+	view.recordMetrics()
+	return updated, nil
+}
+
+func (xds *XDS) updateNodeGroup(ctx context.Context, group string, view *LogicalView) (bool, error) {
+	logger := log.FromContext(ctx).With(slog.String("node_group", group))
 
 	resources := map[resource.Type][]types.Resource{
 		resource.ListenerType: utils.CastListeners(view.Listeners()),
+		resource.RouteType:    utils.CastRoutes(view.Routes()),
 		resource.ClusterType:  utils.CastClusters(view.Clusters()),
+		resource.EndpointType: utils.CastLoadAssignments(view.LoadAssignments()),
 	}
 
 	// Calculate hash of resources
-	newHash, err := xds.calculateResourcesHash(resources)
+	newHash, versionMap, err := xds.calculateResourcesHash(resources)
 	if err != nil {
-		return fmt.Errorf("failed to calculate hash: %w", err)
+		return false, fmt.Errorf("failed to calculate hash: %w", err)
 	}
 
 	// Skip update if hash hasn't changed
-	if xds.lastHash == newHash {
+	previousHash := xds.lastHash[group]
+	if previousHash == newHash {
 		logger.Info("Configuration unchanged, skipping snapshot update", slog.String("hash", newHash))
-		return nil
+		return false, nil
 	}
 
 	// Create snapshot with hash as version
@@ -219,25 +627,23 @@ func (xds *XDS) updateView(ctx context.Context, view *LogicalView) error {
 	)
 
 	if err != nil {
-		return err
+		return false, err
 	}
+	// Per-resource versions let delta xDS clients receive only the resources that changed
+	snap.VersionMap = versionMap
 
 	if err := snap.Consistent(); err != nil {
-		return err
+		return false, err
 	}
 
-	if err := xds.cacheManager.SetSnapshot(ctx, "all", snap); err != nil {
-		return err
+	if err := xds.cacheManager.SetSnapshot(ctx, group, snap); err != nil {
+		return false, err
 	}
+	metrics.SnapshotVersion.DeletePartialMatch(prometheus.Labels{"node_group": group})
+	metrics.SnapshotVersion.WithLabelValues(group, newHash).Set(1)
+	metrics.SnapshotUpdates.WithLabelValues(group).Inc()
 
-	logger.Info("Snapshot updated", slog.String("version", newHash), slog.String("previous_version", xds.lastHash))
-	xds.lastHash = newHash
-	return nil
-}
-
-type AllCache struct {
-}
-
-func (c AllCache) ID(node *corev3.Node) string {
-	return "all"
+	logger.Info("Snapshot updated", slog.String("version", newHash), slog.String("previous_version", previousHash))
+	xds.lastHash[group] = newHash
+	return true, nil
 }
@@ -3,32 +3,158 @@ package envoy
 import (
 	"context"
 	"log/slog"
+	"sync"
 
 	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
 	discoveryv3 "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
 	"github.com/paragor/faraway-edge/pkg/log"
+	"github.com/paragor/faraway-edge/pkg/metrics"
+	statuspb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc/peer"
 )
 
-// XDSCallbacks implements server.Callbacks with structured logging
+// XDSCallbacks implements server.Callbacks with structured logging and metrics
 type XDSCallbacks struct {
-	ctx context.Context
+	ctx          context.Context
+	configStatus *ConfigStatusTracker
+	nodes        *NodeRegistry
+
+	mu      sync.Mutex
+	streams map[int64]*streamInfo
+}
+
+// streamInfo remembers who is on the other end of a stream and what was sent to it.
+type streamInfo struct {
+	nodeID      string
+	nodeCluster string
+	// typeURLs are the labels the stream is counted under in metrics.XDSStreams
+	typeURLs map[string]struct{}
+	// responses maps the nonce of every unanswered response to what it carried
+	responses map[string]sentResponse
+}
+
+type sentResponse struct {
+	typeURL string
+	version string
 }
 
-func NewXDSCallbacks(ctx context.Context) *XDSCallbacks {
-	return &XDSCallbacks{ctx: ctx}
+func NewXDSCallbacks(ctx context.Context, configStatus *ConfigStatusTracker, nodes *NodeRegistry) *XDSCallbacks {
+	return &XDSCallbacks{ctx: ctx, configStatus: configStatus, nodes: nodes, streams: map[int64]*streamInfo{}}
+}
+
+func (cb *XDSCallbacks) stream(streamID int64, node *corev3.Node) *streamInfo {
+	stream, ok := cb.streams[streamID]
+	if !ok {
+		stream = &streamInfo{typeURLs: map[string]struct{}{}, responses: map[string]sentResponse{}}
+		cb.streams[streamID] = stream
+	}
+	// Envoy may only send the node in the first request of a stream
+	if stream.nodeID == "" && node != nil {
+		stream.nodeID = node.Id
+		stream.nodeCluster = node.Cluster
+	}
+	return stream
+}
+
+// trackRequest counts a request as an initial request, ACK or NACK, records
+// the type URL it subscribes the stream to and updates the config status of the node.
+// For state-of-the-world xDS ackVersion is the version in the request; delta
+// requests carry none, so it is looked up by the response nonce.
+func (cb *XDSCallbacks) trackRequest(streamID int64, node *corev3.Node, typeURL, responseNonce, ackVersion string, errorDetail *statuspb.Status) {
+	kind := "ack"
+	if responseNonce == "" {
+		kind = "request"
+	} else if errorDetail != nil {
+		kind = "nack"
+	}
+	metrics.XDSRequests.WithLabelValues(typeURL, kind).Inc()
+
+	cb.nodes.identify(streamID, node)
+
+	cb.mu.Lock()
+	stream := cb.stream(streamID, node)
+	if _, ok := stream.typeURLs[typeURL]; !ok {
+		stream.typeURLs[typeURL] = struct{}{}
+		metrics.XDSStreams.WithLabelValues(typeURL, stream.nodeCluster).Inc()
+		cb.nodes.subscribe(streamID, typeURL)
+	}
+	response, responded := stream.responses[responseNonce]
+	if responded {
+		// Responses to the same type sent before this one are superseded and will never be answered
+		for nonce, other := range stream.responses {
+			if other.typeURL == response.typeURL {
+				delete(stream.responses, nonce)
+			}
+		}
+	}
+	nodeID, nodeCluster := stream.nodeID, stream.nodeCluster
+	cb.mu.Unlock()
+
+	if !responded {
+		return
+	}
+	if errorDetail == nil {
+		if ackVersion == "" {
+			ackVersion = response.version
+		}
+		cb.configStatus.ack(streamID, nodeID, nodeCluster, typeURL, ackVersion)
+		cb.nodes.ack(streamID, typeURL, ackVersion)
+		return
+	}
+
+	cb.configStatus.nack(streamID, nodeID, nodeCluster, typeURL, response.version, errorDetail.GetMessage())
+	log.FromContext(cb.ctx).Error("envoy rejected config",
+		slog.Int64("stream_id", streamID),
+		slog.String("type_url", typeURL),
+		slog.String("version", response.version),
+		slog.String("accepted_version", ackVersion),
+		slog.String("node_id", nodeID),
+		slog.String("node_cluster", nodeCluster),
+		slog.String("error", errorDetail.GetMessage()))
+}
+
+func (cb *XDSCallbacks) trackResponse(streamID int64, node *corev3.Node, typeURL, nonce, version string) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	cb.stream(streamID, node).responses[nonce] = sentResponse{typeURL: typeURL, version: version}
+}
+
+func (cb *XDSCallbacks) forgetStream(streamID int64) {
+	cb.configStatus.forgetStream(streamID)
+	cb.nodes.close(streamID)
+
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	stream, ok := cb.streams[streamID]
+	if !ok {
+		return
+	}
+	for typeURL := range stream.typeURLs {
+		metrics.XDSStreams.WithLabelValues(typeURL, stream.nodeCluster).Dec()
+	}
+	delete(cb.streams, streamID)
 }
 
 func (cb *XDSCallbacks) OnStreamOpen(ctx context.Context, streamID int64, typeURL string) error {
+	cb.nodes.open(streamID, false, peerAddress(ctx))
 	logger := log.FromContext(cb.ctx)
 	node := extractNodeFromContext(ctx)
 	logger.Info("stream opened",
 		slog.Int64("stream_id", streamID),
 		slog.String("type_url", typeURL),
+		slog.String("peer_address", peerAddress(ctx)),
 		slog.String("node_id", node.Id),
 		slog.String("node_cluster", node.Cluster))
 	return nil
 }
 
+func peerAddress(ctx context.Context) string {
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		return p.Addr.String()
+	}
+	return ""
+}
+
 func extractNodeFromContext(ctx context.Context) *corev3.Node {
 	// Try to extract node from context value
 	if node, ok := ctx.Value("node").(*corev3.Node); ok && node != nil {
@@ -39,6 +165,7 @@ func extractNodeFromContext(ctx context.Context) *corev3.Node {
 }
 
 func (cb *XDSCallbacks) OnStreamClosed(streamID int64, node *corev3.Node) {
+	cb.forgetStream(streamID)
 	logger := log.FromContext(cb.ctx)
 	nodeID := ""
 	nodeCluster := ""
@@ -53,6 +180,7 @@ func (cb *XDSCallbacks) OnStreamClosed(streamID int64, node *corev3.Node) {
 }
 
 func (cb *XDSCallbacks) OnStreamRequest(streamID int64, req *discoveryv3.DiscoveryRequest) error {
+	cb.trackRequest(streamID, req.Node, req.TypeUrl, req.ResponseNonce, req.VersionInfo, req.ErrorDetail)
 	logger := log.FromContext(cb.ctx)
 	nodeID := ""
 	nodeCluster := ""
@@ -71,6 +199,7 @@ func (cb *XDSCallbacks) OnStreamRequest(streamID int64, req *discoveryv3.Discove
 }
 
 func (cb *XDSCallbacks) OnStreamResponse(ctx context.Context, streamID int64, req *discoveryv3.DiscoveryRequest, resp *discoveryv3.DiscoveryResponse) {
+	cb.trackResponse(streamID, req.Node, resp.TypeUrl, resp.Nonce, resp.VersionInfo)
 	logger := log.FromContext(cb.ctx)
 	nodeID := ""
 	nodeCluster := ""
@@ -119,17 +248,20 @@ func (cb *XDSCallbacks) OnFetchResponse(req *discoveryv3.DiscoveryRequest, resp
 }
 
 func (cb *XDSCallbacks) OnDeltaStreamOpen(ctx context.Context, streamID int64, typeURL string) error {
+	cb.nodes.open(streamID, true, peerAddress(ctx))
 	logger := log.FromContext(cb.ctx)
 	node := extractNodeFromContext(ctx)
 	logger.Info("delta stream opened",
 		slog.Int64("stream_id", streamID),
 		slog.String("type_url", typeURL),
+		slog.String("peer_address", peerAddress(ctx)),
 		slog.String("node_id", node.Id),
 		slog.String("node_cluster", node.Cluster))
 	return nil
 }
 
 func (cb *XDSCallbacks) OnDeltaStreamClosed(streamID int64, node *corev3.Node) {
+	cb.forgetStream(streamID)
 	logger := log.FromContext(cb.ctx)
 	nodeID := ""
 	nodeCluster := ""
@@ -144,6 +276,7 @@ func (cb *XDSCallbacks) OnDeltaStreamClosed(streamID int64, node *corev3.Node) {
 }
 
 func (cb *XDSCallbacks) OnStreamDeltaRequest(streamID int64, req *discoveryv3.DeltaDiscoveryRequest) error {
+	cb.trackRequest(streamID, req.Node, req.TypeUrl, req.ResponseNonce, "", req.ErrorDetail)
 	logger := log.FromContext(cb.ctx)
 	nodeID := ""
 	nodeCluster := ""
@@ -154,12 +287,15 @@ func (cb *XDSCallbacks) OnStreamDeltaRequest(streamID int64, req *discoveryv3.De
 	logger.Info("delta request received",
 		slog.Int64("stream_id", streamID),
 		slog.String("type_url", req.TypeUrl),
+		slog.Int("subscribe_count", len(req.ResourceNamesSubscribe)),
+		slog.Int("unsubscribe_count", len(req.ResourceNamesUnsubscribe)),
 		slog.String("node_id", nodeID),
 		slog.String("node_cluster", nodeCluster))
 	return nil
 }
 
 func (cb *XDSCallbacks) OnStreamDeltaResponse(streamID int64, req *discoveryv3.DeltaDiscoveryRequest, resp *discoveryv3.DeltaDiscoveryResponse) {
+	cb.trackResponse(streamID, req.Node, resp.TypeUrl, resp.Nonce, resp.SystemVersionInfo)
 	logger := log.FromContext(cb.ctx)
 	nodeID := ""
 	nodeCluster := ""
@@ -170,6 +306,8 @@ func (cb *XDSCallbacks) OnStreamDeltaResponse(streamID int64, req *discoveryv3.D
 	logger.Info("delta response sent",
 		slog.Int64("stream_id", streamID),
 		slog.String("type_url", resp.TypeUrl),
+		slog.Int("resources_count", len(resp.Resources)),
+		slog.Int("removed_resources_count", len(resp.RemovedResources)),
 		slog.String("node_id", nodeID),
 		slog.String("node_cluster", nodeCluster))
-}
\ No newline at end of file
+}
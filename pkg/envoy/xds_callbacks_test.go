@@ -0,0 +1,145 @@
+package envoy
+
+import (
+	"context"
+	"testing"
+
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	discoveryv3 "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+	"github.com/envoyproxy/go-control-plane/pkg/resource/v3"
+	"github.com/paragor/faraway-edge/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	statuspb "google.golang.org/genproto/googleapis/rpc/status"
+)
+
+func newTestCallbacks() (*XDSCallbacks, *ConfigStatusTracker) {
+	configStatus := NewConfigStatusTracker()
+	return NewXDSCallbacks(context.Background(), configStatus, NewNodeRegistry(NodeGroupHash{})), configStatus
+}
+
+// configStatusOf returns the only config status, failing if there is not exactly one.
+func configStatusOf(t *testing.T, configStatus *ConfigStatusTracker) ConfigStatus {
+	t.Helper()
+	statuses := configStatus.Statuses()
+	if len(statuses) != 1 {
+		t.Fatalf("expected 1 config status, got %+v", statuses)
+	}
+	return statuses[0]
+}
+
+func TestXDSCallbacksAckAndNack(t *testing.T) {
+	cb, configStatus := newTestCallbacks()
+	node := &corev3.Node{Id: "edge-1", Cluster: "edge-callbacks"}
+	rejected := metrics.XDSConfigRejected.WithLabelValues("edge-1", "edge-callbacks", resource.ClusterType)
+	const streamID = 1
+
+	if err := cb.OnStreamOpen(context.Background(), streamID, ""); err != nil {
+		t.Fatalf("OnStreamOpen: %v", err)
+	}
+	request := &discoveryv3.DiscoveryRequest{Node: node, TypeUrl: resource.ClusterType}
+	if err := cb.OnStreamRequest(streamID, request); err != nil {
+		t.Fatalf("OnStreamRequest: %v", err)
+	}
+	if statuses := configStatus.Statuses(); len(statuses) != 0 {
+		t.Fatalf("an initial request must not report a status, got %+v", statuses)
+	}
+
+	cb.OnStreamResponse(context.Background(), streamID, request, &discoveryv3.DiscoveryResponse{
+		TypeUrl: resource.ClusterType, VersionInfo: "v1", Nonce: "1",
+	})
+	ack := &discoveryv3.DiscoveryRequest{TypeUrl: resource.ClusterType, VersionInfo: "v1", ResponseNonce: "1"}
+	if err := cb.OnStreamRequest(streamID, ack); err != nil {
+		t.Fatalf("OnStreamRequest: %v", err)
+	}
+	status := configStatusOf(t, configStatus)
+	if status.NodeID != "edge-1" || status.NodeCluster != "edge-callbacks" || status.TypeURL != resource.ClusterType {
+		t.Errorf("unexpected node of the status: %+v", status)
+	}
+	if status.AckedVersion != "v1" || status.Rejected || status.NackedVersion != "" {
+		t.Errorf("expected v1 to be ACKed, got %+v", status)
+	}
+	if value := testutil.ToFloat64(rejected); value != 0 {
+		t.Errorf("expected rejected metric 0 after the ACK, got %v", value)
+	}
+
+	// Two responses before Envoy answers: the first one is superseded
+	for _, nonce := range []string{"2", "3"} {
+		cb.OnStreamResponse(context.Background(), streamID, ack, &discoveryv3.DiscoveryResponse{
+			TypeUrl: resource.ClusterType, VersionInfo: "v" + nonce, Nonce: nonce,
+		})
+	}
+	// A NACK carries the version still in use and the error
+	nack := &discoveryv3.DiscoveryRequest{
+		TypeUrl:       resource.ClusterType,
+		VersionInfo:   "v1",
+		ResponseNonce: "3",
+		ErrorDetail:   &statuspb.Status{Message: "duplicate listener"},
+	}
+	if err := cb.OnStreamRequest(streamID, nack); err != nil {
+		t.Fatalf("OnStreamRequest: %v", err)
+	}
+	status = configStatusOf(t, configStatus)
+	if !status.Rejected || status.NackedVersion != "v3" || status.NackError != "duplicate listener" {
+		t.Errorf("expected v3 to be NACKed, got %+v", status)
+	}
+	if status.AckedVersion != "v1" {
+		t.Errorf("a NACK must keep the ACKed version, got %+v", status)
+	}
+	if value := testutil.ToFloat64(rejected); value != 1 {
+		t.Errorf("expected rejected metric 1 after the NACK, got %v", value)
+	}
+
+	// The superseded nonce is forgotten, a late answer to it changes nothing
+	if err := cb.OnStreamRequest(streamID, &discoveryv3.DiscoveryRequest{TypeUrl: resource.ClusterType, VersionInfo: "v2", ResponseNonce: "2"}); err != nil {
+		t.Fatalf("OnStreamRequest: %v", err)
+	}
+	if status := configStatusOf(t, configStatus); !status.Rejected || status.AckedVersion != "v1" {
+		t.Errorf("a superseded response must not be ACKed, got %+v", status)
+	}
+
+	cb.OnStreamResponse(context.Background(), streamID, nack, &discoveryv3.DiscoveryResponse{
+		TypeUrl: resource.ClusterType, VersionInfo: "v4", Nonce: "4",
+	})
+	if err := cb.OnStreamRequest(streamID, &discoveryv3.DiscoveryRequest{TypeUrl: resource.ClusterType, VersionInfo: "v4", ResponseNonce: "4"}); err != nil {
+		t.Fatalf("OnStreamRequest: %v", err)
+	}
+	if status := configStatusOf(t, configStatus); status.Rejected || status.AckedVersion != "v4" || status.NackedVersion != "v3" {
+		t.Errorf("expected v4 to be ACKed after the NACK of v3, got %+v", status)
+	}
+	if value := testutil.ToFloat64(rejected); value != 0 {
+		t.Errorf("expected rejected metric 0 after the fix, got %v", value)
+	}
+
+	cb.OnStreamClosed(streamID, node)
+	if statuses := configStatus.Statuses(); len(statuses) != 0 {
+		t.Errorf("a closed stream must drop its statuses, got %+v", statuses)
+	}
+	if metrics.XDSConfigRejected.DeleteLabelValues("edge-1", "edge-callbacks", resource.ClusterType) {
+		t.Errorf("a closed stream must drop its rejected metric")
+	}
+}
+
+func TestXDSCallbacksDeltaAck(t *testing.T) {
+	cb, configStatus := newTestCallbacks()
+	node := &corev3.Node{Id: "edge-2", Cluster: "edge-callbacks"}
+	const streamID = 2
+
+	if err := cb.OnDeltaStreamOpen(context.Background(), streamID, ""); err != nil {
+		t.Fatalf("OnDeltaStreamOpen: %v", err)
+	}
+	request := &discoveryv3.DeltaDiscoveryRequest{Node: node, TypeUrl: resource.ListenerType}
+	if err := cb.OnStreamDeltaRequest(streamID, request); err != nil {
+		t.Fatalf("OnStreamDeltaRequest: %v", err)
+	}
+	cb.OnStreamDeltaResponse(streamID, request, &discoveryv3.DeltaDiscoveryResponse{
+		TypeUrl: resource.ListenerType, SystemVersionInfo: "v1", Nonce: "a",
+	})
+	// Delta requests carry no version, it is looked up by the nonce
+	if err := cb.OnStreamDeltaRequest(streamID, &discoveryv3.DeltaDiscoveryRequest{TypeUrl: resource.ListenerType, ResponseNonce: "a"}); err != nil {
+		t.Fatalf("OnStreamDeltaRequest: %v", err)
+	}
+	if status := configStatusOf(t, configStatus); status.AckedVersion != "v1" || status.NodeID != "edge-2" {
+		t.Errorf("expected v1 to be ACKed by edge-2, got %+v", status)
+	}
+	cb.OnDeltaStreamClosed(streamID, node)
+}
@@ -0,0 +1,44 @@
+package envoy
+
+import (
+	"net"
+	"sync/atomic"
+	"testing"
+)
+
+func TestServingListener(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	serving := &atomic.Bool{}
+	wrapped := &servingListener{Listener: lis, serving: serving}
+
+	accepted := make(chan error)
+	go func() {
+		conn, err := wrapped.Accept()
+		if err == nil {
+			conn.Close()
+		}
+		accepted <- err
+	}()
+	conn, err := net.Dial("tcp", lis.Addr().String())
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	conn.Close()
+	if err := <-accepted; err != nil {
+		t.Fatalf("accept: %v", err)
+	}
+	if !serving.Load() {
+		t.Errorf("expected serving once accepting")
+	}
+
+	lis.Close()
+	if _, err := wrapped.Accept(); err == nil {
+		t.Fatalf("expected accept on a closed listener to fail")
+	}
+	if serving.Load() {
+		t.Errorf("expected a failed accept to clear serving")
+	}
+}
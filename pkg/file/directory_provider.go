@@ -0,0 +1,146 @@
+package file
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/paragor/faraway-edge/pkg/envoy"
+	"github.com/paragor/faraway-edge/pkg/log"
+)
+
+// logicalClusterExtensions lists the file extensions picked up from a config directory.
+var logicalClusterExtensions = []string{".json", ".yaml", ".yml"}
+
+// DirectoryProvider serves one LogicalCluster per config file found in a directory,
+// so that every team can own its routing in a separate file. The directory is
+// reloaded as a whole: if any file is invalid or two files conflict, the last
+// good set of clusters keeps being served.
+type DirectoryProvider struct {
+	dir string
+
+	mu       sync.RWMutex
+	clusters []*envoy.LogicalCluster
+	lastErr  error
+
+	changes envoy.ChangeNotifier
+}
+
+func NewDirectoryProvider(dir string) (*DirectoryProvider, error) {
+	p := &DirectoryProvider{dir: filepath.Clean(dir)}
+	clusters, err := LoadLogicalClusterDirectory(p.dir)
+	if err != nil {
+		return nil, err
+	}
+	p.clusters = clusters
+	return p, nil
+}
+
+// LoadLogicalClusterDirectory loads every config file in dir (non-recursively)
+// and checks that cluster names do not conflict between files.
+func LoadLogicalClusterDirectory(dir string) ([]*envoy.LogicalCluster, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("error reading directory %s: %w", dir, err)
+	}
+
+	paths := []string{}
+	for _, entry := range entries {
+		if !isLogicalClusterFile(entry.Name()) {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		// Stat follows symlinks, which is how ConfigMap volumes expose their keys
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("error reading file %s: %w", path, err)
+		}
+		if info.IsDir() {
+			continue
+		}
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	clusters := make([]*envoy.LogicalCluster, 0, len(paths))
+	for _, path := range paths {
+		cluster, err := LoadLogicalCluster(path)
+		if err != nil {
+			return nil, err
+		}
+		clusters = append(clusters, cluster)
+	}
+
+	// Domain conflicts are left to the conflict policy of the view
+	if err := envoy.ValidateLogicalClusterNames(clusters); err != nil {
+		return nil, err
+	}
+	return clusters, nil
+}
+
+func isLogicalClusterFile(name string) bool {
+	if strings.HasPrefix(name, ".") {
+		return false
+	}
+	return slices.Contains(logicalClusterExtensions, strings.ToLower(filepath.Ext(name)))
+}
+
+func (p *DirectoryProvider) Name() string {
+	return "static-dir:" + p.dir
+}
+
+func (p *DirectoryProvider) Run(ctx context.Context) error {
+	ctx = log.PutIntoContext(ctx, log.FromContext(ctx).With(slog.String("dir", p.dir)))
+	logger := log.FromContext(ctx)
+	logger.Info("watching static config directory")
+
+	err := watch(ctx, p.dir, func(name string) bool {
+		return isLogicalClusterFile(filepath.Base(name))
+	}, p.reload)
+
+	logger.Info("shutting down directory provider")
+	return err
+}
+
+func (p *DirectoryProvider) reload(ctx context.Context) {
+	logger := log.FromContext(ctx)
+
+	clusters, err := LoadLogicalClusterDirectory(p.dir)
+
+	p.mu.Lock()
+	p.lastErr = err
+	if err == nil {
+		p.clusters = clusters
+	}
+	p.mu.Unlock()
+
+	if err != nil {
+		logger.Error("failed to reload static config directory, keeping last good config", log.Error(err))
+		return
+	}
+	logger.Info("static config directory reloaded", slog.Int("clusters", len(clusters)))
+	p.changes.Notify()
+}
+
+func (p *DirectoryProvider) Changes() <-chan struct{} {
+	return p.changes.Changes()
+}
+
+// Status returns the error of the last reload attempt, if any.
+func (p *DirectoryProvider) Status() error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.lastErr
+}
+
+func (p *DirectoryProvider) GetLogicalClusters(ctx context.Context) ([]*envoy.LogicalCluster, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.clusters, nil
+}
@@ -0,0 +1,89 @@
+package file
+
+import (
+	"context"
+	"log/slog"
+	"path/filepath"
+	"sync"
+
+	"github.com/paragor/faraway-edge/pkg/envoy"
+	"github.com/paragor/faraway-edge/pkg/log"
+)
+
+// FileProvider serves a LogicalCluster from a file and reloads it on
+// change or SIGHUP. An invalid file never replaces the last good config.
+type FileProvider struct {
+	path string
+
+	mu      sync.RWMutex
+	cluster *envoy.LogicalCluster
+	lastErr error
+
+	changes envoy.ChangeNotifier
+}
+
+func NewFileProvider(path string) (*FileProvider, error) {
+	p := &FileProvider{path: filepath.Clean(path)}
+	cluster, err := LoadLogicalCluster(p.path)
+	if err != nil {
+		return nil, err
+	}
+	p.cluster = cluster
+	return p, nil
+}
+
+func (p *FileProvider) Name() string {
+	return "static:" + p.path
+}
+
+func (p *FileProvider) Run(ctx context.Context) error {
+	ctx = log.PutIntoContext(ctx, log.FromContext(ctx).With(slog.String("path", p.path)))
+	logger := log.FromContext(ctx)
+	logger.Info("watching static config file")
+
+	// Watch the directory rather than the file: editors and ConfigMap mounts
+	// replace the file via rename, which silently drops a watch on the file itself.
+	err := watch(ctx, filepath.Dir(p.path), func(name string) bool {
+		return filepath.Clean(name) == p.path
+	}, p.reload)
+
+	logger.Info("shutting down file provider")
+	return err
+}
+
+func (p *FileProvider) reload(ctx context.Context) {
+	logger := log.FromContext(ctx)
+
+	cluster, err := LoadLogicalCluster(p.path)
+
+	p.mu.Lock()
+	p.lastErr = err
+	if err == nil {
+		p.cluster = cluster
+	}
+	p.mu.Unlock()
+
+	if err != nil {
+		logger.Error("failed to reload static config file, keeping last good config", log.Error(err))
+		return
+	}
+	logger.Info("static config file reloaded")
+	p.changes.Notify()
+}
+
+func (p *FileProvider) Changes() <-chan struct{} {
+	return p.changes.Changes()
+}
+
+// Status returns the error of the last reload attempt, if any.
+func (p *FileProvider) Status() error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.lastErr
+}
+
+func (p *FileProvider) GetLogicalClusters(ctx context.Context) ([]*envoy.LogicalCluster, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return []*envoy.LogicalCluster{p.cluster}, nil
+}
@@ -0,0 +1,63 @@
+package file
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/paragor/faraway-edge/pkg/encodinghelper"
+	"github.com/paragor/faraway-edge/pkg/envoy"
+)
+
+// LoadLogicalCluster reads a LogicalCluster from path, normalizes and validates it.
+// The format is picked by extension: .yaml and .yml are YAML, anything else is JSON.
+// Decoding is strict: unknown fields and type mismatches are all reported with
+// their line and JSON path.
+func LoadLogicalCluster(path string) (*envoy.LogicalCluster, error) {
+	cluster := &envoy.LogicalCluster{}
+	if err := decodeFile(path, cluster); err != nil {
+		return nil, err
+	}
+
+	cluster.Source = path
+	cluster.Normalize()
+
+	// Validation errors name the cluster together with its source file
+	if err := cluster.Validate(); err != nil {
+		return nil, err
+	}
+	return cluster, nil
+}
+
+// LoadViewConfig reads a ViewConfig from path, normalizes and validates it.
+func LoadViewConfig(path string) (*envoy.ViewConfig, error) {
+	config := &envoy.ViewConfig{}
+	if err := decodeFile(path, config); err != nil {
+		return nil, err
+	}
+	config.Normalize()
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return config, nil
+}
+
+func decodeFile(path string, out any) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("error reading file %s: %w", path, err)
+	}
+	if isYAML(path) {
+		return encodinghelper.StrictDecodeYAML(path, data, out)
+	}
+	return encodinghelper.StrictDecodeJSON(path, data, out)
+}
+
+func isYAML(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,71 @@
+package file
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/paragor/faraway-edge/pkg/log"
+)
+
+const reloadDebounce = 200 * time.Millisecond
+
+// watch calls reload whenever a relevant entry of dir changes or SIGHUP is received.
+// Bursts of filesystem events are debounced into a single reload.
+func watch(ctx context.Context, dir string, relevant func(name string) bool, reload func(ctx context.Context)) error {
+	logger := log.FromContext(ctx)
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("error creating file watcher: %w", err)
+	}
+	defer watcher.Close()
+
+	if err := watcher.Add(dir); err != nil {
+		return fmt.Errorf("error watching %s: %w", dir, err)
+	}
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	debounce := time.NewTimer(reloadDebounce)
+	debounce.Stop()
+	defer debounce.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-hup:
+			logger.Info("received SIGHUP, reloading")
+			reload(ctx)
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return fmt.Errorf("file watcher closed")
+			}
+			if relevant(event.Name) || isKubernetesVolumeSwap(event.Name) {
+				debounce.Reset(reloadDebounce)
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return fmt.Errorf("file watcher closed")
+			}
+			logger.Error("file watcher error", log.Error(err))
+		case <-debounce.C:
+			reload(ctx)
+		}
+	}
+}
+
+// isKubernetesVolumeSwap reports whether name is one of the "..data" style
+// entries that ConfigMap and Secret volumes swap atomically on update.
+func isKubernetesVolumeSwap(name string) bool {
+	return strings.HasPrefix(filepath.Base(name), "..")
+}
@@ -5,4 +5,36 @@ const (
 
 	annotationEnabled = annotationPrefix + "enabled"
 	annotationTimeout = annotationPrefix + "timeout"
+	// annotationHttpMode is proxy, redirect or disabled, see envoy.HttpMode
+	annotationHttpMode = annotationPrefix + "http-mode"
+	// annotationHttpRedirectCode is the status code of redirects in redirect mode
+	annotationHttpRedirectCode = annotationPrefix + "http-redirect-code"
+	// annotationProxyProtocol is the PROXY protocol version sent to the ingress controller, v1 or v2
+	annotationProxyProtocol = annotationPrefix + "proxy-protocol"
+	// annotationListenerProxyProtocol is true to serve the ingress on the listeners
+	// accepting PROXY protocol only, false for those accepting connections without it
+	annotationListenerProxyProtocol = annotationPrefix + "listener-proxy-protocol"
+
+	// annotationHealthCheck is tcp (default), http or none. HTTP checks apply to
+	// the HTTP upstream, the HTTPS upstream is checked over TCP with the same settings.
+	annotationHealthCheck                   = annotationPrefix + "health-check"
+	annotationHealthCheckPath               = annotationPrefix + "health-check-path"
+	annotationHealthCheckHost               = annotationPrefix + "health-check-host"
+	annotationHealthCheckExpectedStatuses   = annotationPrefix + "health-check-expected-statuses"
+	annotationHealthCheckInterval           = annotationPrefix + "health-check-interval"
+	annotationHealthCheckTimeout            = annotationPrefix + "health-check-timeout"
+	annotationHealthCheckHealthyThreshold   = annotationPrefix + "health-check-healthy-threshold"
+	annotationHealthCheckUnhealthyThreshold = annotationPrefix + "health-check-unhealthy-threshold"
+
+	// annotationOutlierDetection is true by default, false disables it
+	annotationOutlierDetection                 = annotationPrefix + "outlier-detection"
+	annotationOutlierDetectionConsecutive5xx   = annotationPrefix + "outlier-consecutive-5xx"
+	annotationOutlierDetectionBaseEjectionTime = annotationPrefix + "outlier-base-ejection-time"
+	annotationOutlierDetectionMaxEjection      = annotationPrefix + "outlier-max-ejection-percent"
+
+	healthCheckNone = "none"
+	// defaultOutlierConsecutive5xx and defaultOutlierMaxEjectionPercent let one
+	// of two load balancer addresses be ejected, which the Envoy default of 10% does not
+	defaultOutlierConsecutive5xx     = 5
+	defaultOutlierMaxEjectionPercent = 50
 )
@@ -1,10 +1,12 @@
 package k8s
 
 import (
+	"cmp"
 	"context"
 	"fmt"
 	"log/slog"
 	"slices"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -27,6 +29,7 @@ type IngressProvider struct {
 
 	mu      sync.RWMutex
 	cluster *envoy.LogicalCluster
+	changes envoy.ChangeNotifier
 
 	ingressClasses []string
 	clusterName    string
@@ -70,6 +73,15 @@ func NewIngressProvider(
 	return p, nil
 }
 
+func (p *IngressProvider) Name() string {
+	return "k8s:" + p.clusterName
+}
+
+// LogicalClusterNames returns the only cluster the provider builds from the ingresses.
+func (p *IngressProvider) LogicalClusterNames() []string {
+	return []string{p.clusterName}
+}
+
 func (p *IngressProvider) Run(ctx context.Context) error {
 	defer p.queue.ShutDown()
 
@@ -127,11 +139,16 @@ func (p *IngressProvider) reconcile(ctx context.Context) error {
 	p.mu.Lock()
 	p.cluster = newCluster
 	p.mu.Unlock()
+	p.changes.Notify()
 
 	return nil
 }
 
-func (p *IngressProvider) GetLogicaCluster(ctx context.Context) (*envoy.LogicalCluster, error) {
+func (p *IngressProvider) Changes() <-chan struct{} {
+	return p.changes.Changes()
+}
+
+func (p *IngressProvider) GetLogicalClusters(ctx context.Context) ([]*envoy.LogicalCluster, error) {
 	p.mu.RLock()
 	defer p.mu.RUnlock()
 
@@ -139,7 +156,7 @@ func (p *IngressProvider) GetLogicaCluster(ctx context.Context) (*envoy.LogicalC
 		return nil, fmt.Errorf("not ready")
 	}
 
-	return p.cluster, nil
+	return []*envoy.LogicalCluster{p.cluster}, nil
 }
 
 func (p *IngressProvider) covertIngressToLogicaCluster(ctx context.Context, ingresses []*networkingv1.Ingress) *envoy.LogicalCluster {
@@ -167,37 +184,70 @@ func (p *IngressProvider) covertIngressToLogicaCluster(ctx context.Context, ingr
 		if len(p.collectHosts(ingress)) == 0 {
 			return true
 		}
-		if len(p.collectBalancerIps(ingress)) == 0 {
+		if len(p.collectBalancerIps(ingress)) == 0 && len(p.collectBalancerHostnames(ingress)) == 0 {
 			return true
 		}
 		return false
 	})
 	view := &envoy.LogicalCluster{
-		Name: p.clusterName,
+		Name:   p.clusterName,
+		Source: "k8s",
 	}
 	for _, ingress := range ingresses {
 		logicalIngress := &envoy.LogicalClusterIngress{
-			Name: ingress.GetNamespace() + "/" + ingress.GetName(),
+			Name:      ingress.GetNamespace() + "/" + ingress.GetName(),
+			CreatedAt: ingress.GetCreationTimestamp().Time,
+		}
+		addresses, upstreamType := p.collectBalancerIps(ingress), envoy.UpstreamType("")
+		// Load balancers such as AWS ELB publish a hostname instead of IPs
+		if len(addresses) == 0 {
+			addresses, upstreamType = p.collectBalancerHostnames(ingress), envoy.UpstreamStrictDNS
 		}
-		ips := p.collectBalancerIps(ingress)
 		hosts := p.collectHosts(ingress)
 		timeout := p.getConnectionTimeout(ctx, ingress)
+		// Unknown versions are left to validation, which skips the ingress
+		proxyProtocol := envoy.ProxyProtocolVersion(strings.TrimSpace(ingress.GetAnnotations()[annotationProxyProtocol]))
 
 		logicalIngress.HttpsUpstream = &envoy.EnvoyUpstreamStaticAddresses{
 			Port:            443,
-			StaticAddresses: ips,
+			Type:            upstreamType,
+			StaticAddresses: addresses,
 			ConnectTimeout:  encodinghelper.NewDuration(timeout),
+			ProxyProtocol:   proxyProtocol,
 		}
 		logicalIngress.HttpUpstream = &envoy.EnvoyUpstreamStaticAddresses{
 			Port:            80,
-			StaticAddresses: ips,
+			Type:            upstreamType,
+			StaticAddresses: addresses,
 			ConnectTimeout:  encodinghelper.NewDuration(timeout),
+			ProxyProtocol:   proxyProtocol,
 		}
+		p.setHealthChecks(ctx, ingress, logicalIngress)
+		p.setHttpMode(ctx, ingress, logicalIngress)
+		logicalIngress.ListenerProxyProtocol = p.boolAnnotation(ctx, ingress, annotationListenerProxyProtocol)
 		for _, host := range hosts {
 			logicalIngress.Frontends = append(logicalIngress.Frontends, &envoy.IngressConfig{
 				Domain: host,
 			})
 		}
+		logicalIngress.Normalize()
+		// The same host often appears in several rules of one Ingress
+		seenDomains := map[string]struct{}{}
+		logicalIngress.Frontends = slices.DeleteFunc(logicalIngress.Frontends, func(frontend *envoy.IngressConfig) bool {
+			_, seen := seenDomains[frontend.Domain]
+			seenDomains[frontend.Domain] = struct{}{}
+			return seen
+		})
+		// One invalid Ingress must not invalidate the whole cluster
+		if err := logicalIngress.Validate(); err != nil {
+			log.FromContext(ctx).Warn(
+				"skipping invalid ingress",
+				log.Error(err),
+				slog.String("namespace", ingress.GetNamespace()),
+				slog.String("name", ingress.GetName()),
+			)
+			continue
+		}
 		view.Ingresses = append(view.Ingresses, logicalIngress)
 	}
 
@@ -215,6 +265,16 @@ func (p *IngressProvider) collectBalancerIps(ingress *networkingv1.Ingress) []st
 	return ips
 }
 
+func (p *IngressProvider) collectBalancerHostnames(ingress *networkingv1.Ingress) []string {
+	hostnames := []string{}
+	for _, status := range ingress.Status.LoadBalancer.Ingress {
+		if status.Hostname != "" {
+			hostnames = append(hostnames, status.Hostname)
+		}
+	}
+	return hostnames
+}
+
 func (p *IngressProvider) collectHosts(ingress *networkingv1.Ingress) []string {
 	hosts := []string{}
 	for _, rule := range ingress.Spec.Rules {
@@ -236,6 +296,130 @@ func (p *IngressProvider) collectHosts(ingress *networkingv1.Ingress) []string {
 	}
 	return hosts
 }
+
+// setHealthChecks applies the health check and outlier detection annotations to
+// both upstreams. Every ingress gets a TCP health check and outlier detection
+// by default, so that a dead load balancer address stops receiving traffic.
+func (p *IngressProvider) setHealthChecks(ctx context.Context, ingress *networkingv1.Ingress, logicalIngress *envoy.LogicalClusterIngress) {
+	annotations := ingress.GetAnnotations()
+	healthCheckType := strings.TrimSpace(annotations[annotationHealthCheck])
+	if healthCheckType != healthCheckNone {
+		healthCheck := &envoy.EnvoyHealthCheck{
+			Type:               envoy.HealthCheckType(cmp.Or(healthCheckType, string(envoy.HealthCheckTCP))),
+			Interval:           encodinghelper.NewDuration(p.durationAnnotation(ctx, ingress, annotationHealthCheckInterval)),
+			Timeout:            encodinghelper.NewDuration(p.durationAnnotation(ctx, ingress, annotationHealthCheckTimeout)),
+			HealthyThreshold:   p.uintAnnotation(ctx, ingress, annotationHealthCheckHealthyThreshold),
+			UnhealthyThreshold: p.uintAnnotation(ctx, ingress, annotationHealthCheckUnhealthyThreshold),
+		}
+		httpsHealthCheck := *healthCheck
+		if healthCheck.Type == envoy.HealthCheckHTTP {
+			healthCheck.Path = strings.TrimSpace(annotations[annotationHealthCheckPath])
+			healthCheck.Host = strings.TrimSpace(annotations[annotationHealthCheckHost])
+			for _, status := range strings.Split(annotations[annotationHealthCheckExpectedStatuses], ",") {
+				if status = strings.TrimSpace(status); status == "" {
+					continue
+				}
+				code, err := strconv.ParseUint(status, 10, 32)
+				if err != nil {
+					p.warnAnnotation(ctx, ingress, annotationHealthCheckExpectedStatuses, err)
+					continue
+				}
+				healthCheck.ExpectedStatuses = append(healthCheck.ExpectedStatuses, uint32(code))
+			}
+			// A plain text HTTP request cannot check a TLS upstream
+			httpsHealthCheck.Type = envoy.HealthCheckTCP
+		}
+		logicalIngress.HttpUpstream.HealthCheck = healthCheck
+		logicalIngress.HttpsUpstream.HealthCheck = &httpsHealthCheck
+	}
+
+	if strings.TrimSpace(annotations[annotationOutlierDetection]) == "false" {
+		return
+	}
+	outlierDetection := &envoy.EnvoyOutlierDetection{
+		Consecutive5xx:     cmp.Or(p.uintAnnotation(ctx, ingress, annotationOutlierDetectionConsecutive5xx), defaultOutlierConsecutive5xx),
+		BaseEjectionTime:   encodinghelper.NewDuration(p.durationAnnotation(ctx, ingress, annotationOutlierDetectionBaseEjectionTime)),
+		MaxEjectionPercent: cmp.Or(p.uintAnnotation(ctx, ingress, annotationOutlierDetectionMaxEjection), defaultOutlierMaxEjectionPercent),
+	}
+	httpsOutlierDetection := *outlierDetection
+	logicalIngress.HttpUpstream.OutlierDetection = outlierDetection
+	logicalIngress.HttpsUpstream.OutlierDetection = &httpsOutlierDetection
+}
+
+// durationAnnotation returns the duration in annotation, 0 when unset or invalid.
+func (p *IngressProvider) durationAnnotation(ctx context.Context, ingress *networkingv1.Ingress, annotation string) time.Duration {
+	value := strings.TrimSpace(ingress.GetAnnotations()[annotation])
+	if value == "" {
+		return 0
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		p.warnAnnotation(ctx, ingress, annotation, err)
+		return 0
+	}
+	return duration
+}
+
+// uintAnnotation returns the number in annotation, 0 when unset or invalid.
+func (p *IngressProvider) uintAnnotation(ctx context.Context, ingress *networkingv1.Ingress, annotation string) uint32 {
+	value := strings.TrimSpace(ingress.GetAnnotations()[annotation])
+	if value == "" {
+		return 0
+	}
+	number, err := strconv.ParseUint(value, 10, 32)
+	if err != nil {
+		p.warnAnnotation(ctx, ingress, annotation, err)
+		return 0
+	}
+	return uint32(number)
+}
+
+// boolAnnotation returns the boolean in annotation, nil when unset or invalid.
+func (p *IngressProvider) boolAnnotation(ctx context.Context, ingress *networkingv1.Ingress, annotation string) *bool {
+	value := strings.TrimSpace(ingress.GetAnnotations()[annotation])
+	if value == "" {
+		return nil
+	}
+	result, err := strconv.ParseBool(value)
+	if err != nil {
+		p.warnAnnotation(ctx, ingress, annotation, err)
+		return nil
+	}
+	return &result
+}
+
+func (p *IngressProvider) warnAnnotation(ctx context.Context, ingress *networkingv1.Ingress, annotation string, err error) {
+	log.FromContext(ctx).Warn(
+		"failed to parse annotation, using the default",
+		log.Error(err),
+		slog.String("annotation", annotation),
+		slog.String("namespace", ingress.GetNamespace()),
+		slog.String("name", ingress.GetName()),
+	)
+}
+
+// setHttpMode applies the http mode annotations. Unknown modes and codes are
+// left to validation, which skips the ingress.
+func (p *IngressProvider) setHttpMode(ctx context.Context, ingress *networkingv1.Ingress, logicalIngress *envoy.LogicalClusterIngress) {
+	annotations := ingress.GetAnnotations()
+	logicalIngress.HttpMode = envoy.HttpMode(strings.TrimSpace(annotations[annotationHttpMode]))
+	codeAnnotation := strings.TrimSpace(annotations[annotationHttpRedirectCode])
+	if codeAnnotation == "" {
+		return
+	}
+	code, err := strconv.ParseUint(codeAnnotation, 10, 32)
+	if err != nil {
+		log.FromContext(ctx).Warn(
+			"failed to parse http redirect code annotation",
+			log.Error(err),
+			slog.String("namespace", ingress.GetNamespace()),
+			slog.String("name", ingress.GetName()),
+		)
+		return
+	}
+	logicalIngress.HttpRedirectCode = uint32(code)
+}
+
 func (p *IngressProvider) getConnectionTimeout(ctx context.Context, ingress *networkingv1.Ingress) time.Duration {
 	logger := log.FromContext(ctx)
 	defaultTimeout := time.Second * 5
@@ -0,0 +1,113 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const namespace = "faraway_edge"
+
+var (
+	SnapshotVersion = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "snapshot_version_info",
+		Help:      "Version of the snapshot currently served to a node group, always 1.",
+	}, []string{"node_group", "version"})
+
+	SnapshotUpdates = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "snapshot_updates_total",
+		Help:      "Number of snapshots set for a node group.",
+	}, []string{"node_group"})
+
+	ProviderErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "provider_errors_total",
+		Help:      "Number of times a provider failed to return its logical clusters.",
+	}, []string{"provider"})
+
+	ProviderStale = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "provider_stale",
+		Help:      "1 while a provider fails and its last valid clusters are served or dropped as too old.",
+	}, []string{"provider"})
+
+	ProviderLastSuccess = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "provider_last_success_timestamp_seconds",
+		Help:      "Unix time a provider last returned valid clusters.",
+	}, []string{"provider"})
+
+	DomainConflicts = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "domain_conflicts",
+		Help:      "Number of domains claimed by more than one ingress in the last view, resolved by the conflict policy.",
+	})
+
+	DroppedFrontends = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "dropped_frontends",
+		Help:      "Number of ingress frontends dropped from the last view by the conflict policy.",
+	})
+
+	DomainOverlaps = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "domain_overlaps",
+		Help:      "Number of exact domains in the last view also matched by a wildcard of another ingress.",
+	})
+
+	ViewValidationFailures = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "view_validation_failures_total",
+		Help:      "Number of logical views rejected by validation.",
+	})
+
+	SnapshotPinned = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "snapshot_pinned",
+		Help:      "1 while snapshot updates are frozen at a pinned historical version.",
+	})
+
+	ChangeToSnapshotSeconds = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "change_to_snapshot_seconds",
+		Help:      "Time from a provider change notification to the resulting snapshot being set.",
+		Buckets:   []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
+	})
+
+	ViewLogicalClusters = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "view_logical_clusters",
+		Help:      "Number of logical clusters in the current view.",
+	})
+
+	ViewIngresses = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "view_ingresses",
+		Help:      "Number of ingresses in the current view.",
+	})
+
+	ViewDomains = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "view_domains",
+		Help:      "Number of domains in the current view.",
+	})
+
+	XDSStreams = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "xds_streams",
+		Help:      "Number of open xDS streams by subscribed type URL and node cluster.",
+	}, []string{"type_url", "node_cluster"})
+
+	XDSRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "xds_requests_total",
+		Help:      "Number of xDS requests by type URL and kind: request, ack or nack.",
+	}, []string{"type_url", "kind"})
+
+	XDSConfigRejected = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "xds_config_rejected",
+		Help:      "1 if the latest config of a type sent to a connected node was NACKed, 0 if it was ACKed.",
+	}, []string{"node_id", "node_cluster", "type_url"})
+)
@@ -0,0 +1,45 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"strings"
+)
+
+const unixScheme = "unix://"
+
+// Listen opens a listener for address, which is either a TCP address
+// (host:port, [::1]:port, :port) or a unix socket path (unix:///run/xds.sock).
+// A stale unix socket left over from a previous run is removed first.
+func Listen(address string) (net.Listener, error) {
+	if path, ok := strings.CutPrefix(address, unixScheme); ok {
+		if path == "" {
+			return nil, fmt.Errorf("invalid listen address %q: empty unix socket path", address)
+		}
+		if err := removeStaleSocket(path); err != nil {
+			return nil, err
+		}
+		return net.Listen("unix", path)
+	}
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		return nil, fmt.Errorf("invalid listen address %q: %w", address, err)
+	}
+	return net.Listen("tcp", address)
+}
+
+func removeStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Mode().Type() != fs.ModeSocket {
+		return fmt.Errorf("cant listen on %s: file exists and is not a socket", path)
+	}
+	return os.Remove(path)
+}
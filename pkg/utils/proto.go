@@ -6,7 +6,9 @@ import (
 	"sort"
 
 	clusterv3 "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
+	endpointv3 "github.com/envoyproxy/go-control-plane/envoy/config/endpoint/v3"
 	listenerv3 "github.com/envoyproxy/go-control-plane/envoy/config/listener/v3"
+	routev3 "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
 	"github.com/envoyproxy/go-control-plane/pkg/cache/types"
 	"github.com/envoyproxy/go-control-plane/pkg/cache/v3"
 	"github.com/envoyproxy/go-control-plane/pkg/resource/v3"
@@ -78,3 +80,19 @@ func CastClusters(rr []*clusterv3.Cluster) []types.Resource {
 	}
 	return res
 }
+
+func CastRoutes(rr []*routev3.RouteConfiguration) []types.Resource {
+	res := make([]types.Resource, 0, len(rr))
+	for _, r := range rr {
+		res = append(res, r)
+	}
+	return res
+}
+
+func CastLoadAssignments(rr []*endpointv3.ClusterLoadAssignment) []types.Resource {
+	res := make([]types.Resource, 0, len(rr))
+	for _, r := range rr {
+		res = append(res, r)
+	}
+	return res
+}